@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 5
+	maxNameLength     = 20
+	loginFailDelay    = 2 * time.Second // Slows down password guessing
+)
+
+// Ranks, in increasing order of trust
+const (
+	rankPlayer rank = iota
+	rankBuilder
+	rankAdmin
+)
+
+var (
+	errConnClosed = errors.New("connection closed")
+	errLastAdmin  = errors.New("no admins would be left")
+	ranks         = map[string]rank{
+		"player":  rankPlayer,
+		"builder": rankBuilder,
+		"admin":   rankAdmin,
+	}
+)
+
+// A registered character
+type account struct {
+	name     string // Canonical capitalization of the name
+	password []byte // bcrypt hash, which includes the salt
+	created  time.Time
+}
+
+// Look up an account by name, ignoring case.
+// Returns sql.ErrNoRows if there is no such account
+func findAccount(name string) (*account, error) {
+	var a *account
+	err := readTransaction(func(tx *sql.Tx) error {
+		var (
+			stored   string
+			password []byte
+			created  int64
+		)
+		row := tx.QueryRow("SELECT name, password, created FROM accounts WHERE name = ?", name)
+		if err := row.Scan(&stored, &password, &created); err != nil {
+			return err
+		}
+		a = &account{
+			name:     stored,
+			password: password,
+			created:  time.Unix(created, 0),
+		}
+		return nil
+	})
+	return a, err
+}
+
+// Store a new account with a hashed password
+func createAccount(name string, password string) (*account, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("hashing password: %v", err)
+	}
+	a := &account{
+		name:     name,
+		password: hash,
+		created:  time.Now(),
+	}
+	err = writeTransaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO accounts (name, password, created) VALUES (?, ?, ?)", a.name, a.password, a.created.Unix())
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("inserting account: %v", err)
+	}
+	return a, nil
+}
+
+// Whether the password matches the stored hash
+func (a *account) checkPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(a.password, []byte(password)) == nil
+}
+
+// Make sure a name is usable as a character name
+func validateName(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("Username must not be empty")
+	}
+	if len(strings.Fields(name)) > 1 {
+		return fmt.Errorf("Username must be one word")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("Username must be less than %d characters", maxNameLength+1)
+	}
+	for _, ch := range name {
+		if !unicode.IsLetter(ch) {
+			return fmt.Errorf("Username may only contain letters")
+		}
+	}
+	return nil
+}
+
+// Prompt for a name and password until a player has entered the world or the connection closes
+func login(conn *telnetConn, scanner *bufio.Scanner, clientLog *log.Logger, inputs chan input) (*player, error) {
+	for {
+		name, ok := ask(conn, scanner, "Please enter your name: ")
+		if !ok {
+			return nil, errConnClosed
+		}
+		if err := validateName(name); err != nil {
+			fmt.Fprintln(conn, err)
+			continue
+		}
+
+		a, err := findAccount(name)
+		switch {
+		case err == sql.ErrNoRows:
+			a, err = registerPrompt(conn, scanner, name)
+		case err != nil:
+			serverLog.Printf("looking up account '%s': %v", name, err)
+			err = fmt.Errorf("Unable to log in right now, please try again later")
+		default:
+			err = passwordPrompt(conn, scanner, a)
+		}
+		if err == errConnClosed {
+			return nil, err
+		}
+		if err != nil {
+			fmt.Fprintln(conn, err)
+			continue
+		}
+
+		p := newPlayer(a.name, conn, clientLog)
+		if err := p.loadState(); err != nil {
+			serverLog.Printf("loading player '%s': %v", p.name, err)
+			fmt.Fprintln(conn, "Unable to load your character, please try again later")
+			continue
+		}
+
+		// Ask the world goroutine to let us in
+		joined := make(chan error)
+		inputs <- input{player: p, join: joined}
+		if err := <-joined; err != nil {
+			fmt.Fprintln(conn, err)
+			continue
+		}
+		return p, nil
+	}
+}
+
+// Ask for the password of an existing account
+func passwordPrompt(conn *telnetConn, scanner *bufio.Scanner, a *account) error {
+	password, ok := askSecret(conn, scanner, "Password: ")
+	if !ok {
+		return errConnClosed
+	}
+	if !a.checkPassword(password) {
+		serverLog.Printf("failed login for '%s' from %s", a.name, conn.RemoteAddr().String())
+		time.Sleep(loginFailDelay)
+		return fmt.Errorf("Wrong password")
+	}
+	return nil
+}
+
+// Offer to create a new account with the given name
+func registerPrompt(conn *telnetConn, scanner *bufio.Scanner, name string) (*account, error) {
+	answer, ok := ask(conn, scanner, fmt.Sprintf("No character named %s exists. Create it? (y/n) ", name))
+	if !ok {
+		return nil, errConnClosed
+	}
+	if !strings.HasPrefix(strings.ToLower(answer), "y") {
+		return nil, fmt.Errorf("Okay, pick another name then")
+	}
+
+	password, ok := askSecret(conn, scanner, "Choose a password: ")
+	if !ok {
+		return nil, errConnClosed
+	}
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("Password must be at least %d characters", minPasswordLength)
+	}
+	confirm, ok := askSecret(conn, scanner, "Confirm password: ")
+	if !ok {
+		return nil, errConnClosed
+	}
+	if password != confirm {
+		return nil, fmt.Errorf("Passwords don't match")
+	}
+
+	a, err := createAccount(name, password)
+	if err != nil {
+		serverLog.Printf("creating account '%s': %v", name, err)
+		return nil, fmt.Errorf("Unable to create that character, try another name")
+	}
+	serverLog.Printf("account '%s' created from %s", a.name, conn.RemoteAddr().String())
+	return a, nil
+}
+
+// Ask a question and read a line of input. Returns false if the connection closed
+func ask(conn *telnetConn, scanner *bufio.Scanner, question string) (string, bool) {
+	fmt.Fprint(conn, question)
+	if !scanner.Scan() {
+		return "", false
+	}
+	return strings.TrimSpace(scanner.Text()), true
+}
+
+// Ask a question without echoing the answer back to the client
+func askSecret(conn *telnetConn, scanner *bufio.Scanner, question string) (string, bool) {
+	conn.setEcho(false)
+	defer conn.setEcho(true)
+	answer, ok := ask(conn, scanner, question)
+	// The client didn't echo the newline either
+	fmt.Fprintln(conn)
+	return answer, ok
+}
+
+// Change how much a player is trusted
+func (p *player) doPromote(cmd string) {
+	words := strings.Fields(cmd)
+	r, valid := rankPlayer, false
+	if len(words) == 2 {
+		r, valid = ranks[strings.ToLower(words[1])]
+	}
+	if !valid {
+		p.send(event{
+			player: p,
+			output: "Usage: promote <player name> <player|builder|admin>",
+			err:    true,
+		})
+		return
+	}
+	a, err := findAccount(words[0])
+	if err == sql.ErrNoRows {
+		p.send(event{
+			player: p,
+			output: "No such player!",
+			err:    true,
+		})
+		return
+	}
+	if err == nil {
+		err = writeTransaction(func(tx *sql.Tx) error {
+			if _, err := tx.Exec("UPDATE accounts SET rank = ? WHERE name = ?", strings.ToLower(words[1]), a.name); err != nil {
+				return err
+			}
+			// Someone has to be left to promote others
+			var admins int
+			if err := tx.QueryRow("SELECT COUNT(*) FROM accounts WHERE rank = 'admin'").Scan(&admins); err != nil {
+				return err
+			}
+			if admins == 0 {
+				return errLastAdmin
+			}
+			return nil
+		})
+	}
+	if err == errLastAdmin {
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("%s is the last admin, promote someone else to admin first.", a.name),
+			err:    true,
+		})
+		return
+	}
+	if err != nil {
+		serverLog.Printf("promoting '%s': %v", words[0], err)
+		p.send(event{
+			player: p,
+			output: "Something went wrong, nothing was changed.",
+			err:    true,
+		})
+		return
+	}
+	if other, online := players[a.name]; online {
+		other.rank = r
+		if other != p {
+			other.send(event{
+				player: p,
+				output: fmt.Sprintf("%s changed your rank to %s.", p.name, strings.ToLower(words[1])),
+			})
+		}
+	}
+	p.send(event{
+		player: p,
+		output: fmt.Sprintf("%s now has the rank of %s.", a.name, strings.ToLower(words[1])),
+	})
+}
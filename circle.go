@@ -0,0 +1,635 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Bits in CircleMUD flag fields
+const (
+	circleRoomPeaceful = 1 << 4 // Room flag 'e'
+	circleMobSentinel  = 1 << 1 // Action flag 'b', never wanders
+	circleMobStayZone  = 1 << 6 // Action flag 'g'
+	circlePickproof    = 2      // Door flag for a lock that can't be picked. Any other non-zero flag is a plain door
+	circleWander       = 20     // Percent chance to move for mobiles that aren't sentinels
+)
+
+var (
+	circleDirs       = []string{"n", "e", "s", "w", "u", "d"} // Circle's direction numbers in order
+	circleDoorStates = []string{"open", "closed", "locked"}   // Door states in zone resets
+)
+
+type (
+	// Everything read from a set of area files, before it is written to the database
+	circleArea struct {
+		zones   []circleZone
+		rooms   []circleRoom
+		objects []circleObject
+		mobiles []circleMobile
+	}
+
+	circleZone struct {
+		id     int
+		name   string
+		resets []circleReset
+	}
+
+	// One line of a zone's reset commands that we know how to use
+	circleReset struct {
+		command byte // M, O or D
+		args    []int
+	}
+
+	circleRoom struct {
+		id          int
+		zone        int
+		name        string
+		description string
+		flags       int
+		exits       []circleExit
+	}
+
+	circleExit struct {
+		dir         int
+		description string
+		keywords    string
+		doorFlags   int
+		key         int
+		to          int
+	}
+
+	circleObject struct {
+		id          int
+		keywords    string
+		name        string
+		ground      string
+		description string
+	}
+
+	circleMobile struct {
+		id          int
+		keywords    string
+		name        string
+		description string
+		flags       int
+		level       int
+	}
+
+	// Reads an area file a line at a time
+	circleReader struct {
+		path  string
+		lines []string
+		pos   int
+	}
+)
+
+func newCircleReader(path string) (*circleReader, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &circleReader{
+		path:  path,
+		lines: strings.Split(strings.ReplaceAll(string(data), "\r", ""), "\n"),
+	}, nil
+}
+
+func (r *circleReader) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", r.path, r.pos, fmt.Sprintf(format, a...))
+}
+
+// The next line, or false at the end of the file
+func (r *circleReader) line() (string, bool) {
+	if r.pos >= len(r.lines) {
+		return "", false
+	}
+	r.pos++
+	return strings.TrimRight(r.lines[r.pos-1], " \t"), true
+}
+
+// The next line that isn't blank
+func (r *circleReader) nextLine() (string, bool) {
+	for {
+		l, ok := r.line()
+		if !ok || strings.TrimSpace(l) != "" {
+			return strings.TrimSpace(l), ok
+		}
+	}
+}
+
+// A string ending with '~', which may span several lines
+func (r *circleReader) text() (string, error) {
+	var b strings.Builder
+	for {
+		l, ok := r.line()
+		if !ok {
+			return "", r.errorf("missing '~' at the end of a string")
+		}
+		if i := strings.IndexByte(l, '~'); i != -1 {
+			b.WriteString(l[:i])
+			return b.String(), nil
+		}
+		b.WriteString(l + "\n")
+	}
+}
+
+// The numbers on the next line
+func (r *circleReader) numbers(want int) ([]int, error) {
+	l, ok := r.nextLine()
+	if !ok {
+		return nil, r.errorf("unexpected end of file")
+	}
+	fields := strings.Fields(l)
+	if len(fields) < want {
+		return nil, r.errorf("expected %d numbers, found %q", want, l)
+	}
+	nums := make([]int, want)
+	for i := range nums {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return nil, r.errorf("expected a number, found %q", fields[i])
+		}
+		nums[i] = n
+	}
+	return nums, nil
+}
+
+// The vnum of the next record, or false at the '$' that ends the file
+func (r *circleReader) vnum() (int, bool, error) {
+	l, ok := r.nextLine()
+	if !ok || strings.HasPrefix(l, "$") {
+		return 0, false, nil
+	}
+	if !strings.HasPrefix(l, "#") {
+		return 0, false, r.errorf("expected #<vnum>, found %q", l)
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(l[1:]))
+	if err != nil {
+		return 0, false, r.errorf("bad vnum %q", l)
+	}
+	return id, true, nil
+}
+
+// Parse a flag field, either a number or letters standing for bits ('a' is 1, 'b' is 2, ...)
+func circleFlags(s string) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	bits := 0
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z':
+			bits |= 1 << uint(c-'a')
+		case c >= 'A' && c <= 'F':
+			bits |= 1 << uint(26+c-'A')
+		}
+	}
+	return bits
+}
+
+// Rooms and their exits from a .wld file
+func (a *circleArea) readWorld(r *circleReader) error {
+	for {
+		id, more, err := r.vnum()
+		if err != nil || !more {
+			return err
+		}
+		room := circleRoom{id: id}
+		if room.name, err = r.text(); err != nil {
+			return err
+		}
+		if room.description, err = r.text(); err != nil {
+			return err
+		}
+		l, _ := r.nextLine()
+		fields := strings.Fields(l)
+		if len(fields) < 2 {
+			return r.errorf("room %d: expected zone and flags, found %q", id, l)
+		}
+		if room.zone, err = strconv.Atoi(fields[0]); err != nil {
+			return r.errorf("room %d: bad zone %q", id, fields[0])
+		}
+		room.flags = circleFlags(fields[1])
+
+		for done := false; !done; {
+			l, ok := r.nextLine()
+			if !ok {
+				return r.errorf("room %d: missing 'S' at the end", id)
+			}
+			switch {
+			case l == "S":
+				done = true
+			case strings.HasPrefix(l, "D"):
+				e := circleExit{}
+				if e.dir, err = strconv.Atoi(l[1:]); err != nil || e.dir < 0 || e.dir >= len(circleDirs) {
+					return r.errorf("room %d: bad exit %q", id, l)
+				}
+				if e.description, err = r.text(); err != nil {
+					return err
+				}
+				if e.keywords, err = r.text(); err != nil {
+					return err
+				}
+				nums, err := r.numbers(3)
+				if err != nil {
+					return err
+				}
+				e.doorFlags, e.key, e.to = nums[0], nums[1], nums[2]
+				room.exits = append(room.exits, e)
+			case l == "E":
+				// Extra descriptions have nowhere to go yet
+				if _, err := r.text(); err != nil {
+					return err
+				}
+				if _, err := r.text(); err != nil {
+					return err
+				}
+			}
+			// Anything else, like trigger lines, is skipped
+		}
+		a.rooms = append(a.rooms, room)
+	}
+}
+
+// Zone names and the resets that place mobiles, items and door states, from a .zon file
+func (a *circleArea) readZone(r *circleReader) error {
+	id, more, err := r.vnum()
+	if err != nil || !more {
+		return err
+	}
+	z := circleZone{id: id}
+	if z.name, err = r.text(); err != nil {
+		return err
+	}
+	// Room range, lifespan and reset mode
+	if _, ok := r.nextLine(); !ok {
+		return r.errorf("zone %d: unexpected end of file", id)
+	}
+	for {
+		l, ok := r.nextLine()
+		if !ok || l == "S" || strings.HasPrefix(l, "$") {
+			break
+		}
+		fields := strings.Fields(l)
+		if len(fields) < 5 || !strings.Contains("MOD", fields[0]) || len(fields[0]) != 1 {
+			continue
+		}
+		reset := circleReset{command: fields[0][0]}
+		for _, f := range fields[2:5] {
+			n, err := strconv.Atoi(f)
+			if err != nil {
+				return r.errorf("zone %d: bad reset %q", id, l)
+			}
+			reset.args = append(reset.args, n)
+		}
+		z.resets = append(z.resets, reset)
+	}
+	a.zones = append(a.zones, z)
+	return nil
+}
+
+// Objects from an .obj file
+func (a *circleArea) readObjects(r *circleReader) error {
+	id, more, err := r.vnum()
+	for err == nil && more {
+		o := circleObject{id: id}
+		if o.keywords, err = r.text(); err != nil {
+			return err
+		}
+		if o.name, err = r.text(); err != nil {
+			return err
+		}
+		if o.ground, err = r.text(); err != nil {
+			return err
+		}
+		// Action description
+		if _, err := r.text(); err != nil {
+			return err
+		}
+		// Type and flags, values, and weight, cost and rent
+		for i := 0; i < 3; i++ {
+			if _, ok := r.nextLine(); !ok {
+				return r.errorf("object %d: unexpected end of file", id)
+			}
+		}
+		// Extra descriptions and affects, until the next object
+		for {
+			l, ok := r.nextLine()
+			if !ok || strings.HasPrefix(l, "#") || strings.HasPrefix(l, "$") {
+				r.pos--
+				break
+			}
+			switch l {
+			case "E":
+				if _, err := r.text(); err != nil {
+					return err
+				}
+				desc, err := r.text()
+				if err != nil {
+					return err
+				}
+				if o.description == "" {
+					o.description = desc
+				}
+			case "A":
+				r.nextLine()
+			}
+		}
+		if o.description == "" {
+			o.description = o.ground
+		}
+		a.objects = append(a.objects, o)
+		id, more, err = r.vnum()
+	}
+	return err
+}
+
+// Mobiles from a .mob file
+func (a *circleArea) readMobiles(r *circleReader) error {
+	id, more, err := r.vnum()
+	for err == nil && more {
+		m := circleMobile{id: id}
+		if m.keywords, err = r.text(); err != nil {
+			return err
+		}
+		if m.name, err = r.text(); err != nil {
+			return err
+		}
+		long, err := r.text()
+		if err != nil {
+			return err
+		}
+		if m.description, err = r.text(); err != nil {
+			return err
+		}
+		if strings.TrimSpace(m.description) == "" {
+			m.description = long
+		}
+		l, _ := r.nextLine()
+		fields := strings.Fields(l)
+		if len(fields) < 2 {
+			return r.errorf("mobile %d: expected flags, found %q", id, l)
+		}
+		m.flags = circleFlags(fields[0])
+		enhanced := fields[len(fields)-1] == "E"
+		nums, err := r.numbers(1)
+		if err != nil {
+			return err
+		}
+		m.level = nums[0]
+		// Gold and experience, and positions
+		r.nextLine()
+		r.nextLine()
+		if enhanced {
+			for {
+				l, ok := r.nextLine()
+				if !ok {
+					return r.errorf("mobile %d: missing 'E' at the end", id)
+				}
+				if l == "E" {
+					break
+				}
+			}
+		}
+		a.mobiles = append(a.mobiles, m)
+		id, more, err = r.vnum()
+	}
+	return err
+}
+
+// Read area files, choosing how by their extension
+func readCircleFiles(paths []string) (*circleArea, error) {
+	a := &circleArea{}
+	for _, path := range paths {
+		r, err := newCircleReader(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading area file: %v", err)
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".wld":
+			err = a.readWorld(r)
+		case ".zon":
+			err = a.readZone(r)
+		case ".obj":
+			err = a.readObjects(r)
+		case ".mob":
+			err = a.readMobiles(r)
+		default:
+			err = fmt.Errorf("%s: not a .wld, .zon, .obj or .mob file", path)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Whether a row with an id exists in a table
+func rowExists(tx *sql.Tx, table string, id int) (bool, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE id = ?", id).Scan(&n)
+	return n > 0, err
+}
+
+// Write an area to the database. Rows with the same vnum are replaced, and exits that lead
+// to rooms that don't exist are left out. Warnings are sent to warn
+func (a *circleArea) write(tx *sql.Tx, warn func(format string, a ...interface{})) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, z := range a.zones {
+		if _, err := tx.Exec("INSERT INTO zones (id, name) VALUES (?, ?) ON CONFLICT(id) DO UPDATE SET name = excluded.name", z.id, z.name); err != nil {
+			return nil, fmt.Errorf("writing zone %d: %v", z.id, err)
+		}
+		counts["zone"]++
+	}
+	for _, r := range a.rooms {
+		// Zones without a .zon file get a placeholder name
+		if _, err := tx.Exec("INSERT OR IGNORE INTO zones (id, name) VALUES (?, ?)", r.zone, fmt.Sprintf("Zone %d", r.zone)); err != nil {
+			return nil, fmt.Errorf("writing zone %d: %v", r.zone, err)
+		}
+		flags := ""
+		if r.flags&circleRoomPeaceful != 0 {
+			flags = "peaceful"
+		}
+		_, err := tx.Exec(`INSERT INTO rooms (id, zone_id, name, description, flags) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET zone_id = excluded.zone_id, name = excluded.name, description = excluded.description, flags = excluded.flags`,
+			r.id, r.zone, r.name, r.description, flags)
+		if err != nil {
+			return nil, fmt.Errorf("writing room %d: %v", r.id, err)
+		}
+		counts["room"]++
+	}
+	for _, o := range a.objects {
+		_, err := tx.Exec(`INSERT INTO objects (id, keywords, name, ground, description) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET keywords = excluded.keywords, name = excluded.name, ground = excluded.ground, description = excluded.description`,
+			o.id, o.keywords, o.name, strings.TrimSpace(o.ground), strings.TrimSpace(o.description))
+		if err != nil {
+			return nil, fmt.Errorf("writing object %d: %v", o.id, err)
+		}
+		counts["object"]++
+	}
+	for _, m := range a.mobiles {
+		wander := circleWander
+		if m.flags&circleMobSentinel != 0 {
+			wander = 0
+		}
+		// Circle's numbers are far beyond ours, so stats are scaled from the level
+		_, err := tx.Exec(`INSERT INTO mobiles (id, keywords, name, description, wander, stay_zone, max_hit_points, strength, dexterity) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET keywords = excluded.keywords, name = excluded.name, description = excluded.description, wander = excluded.wander,
+				stay_zone = excluded.stay_zone, max_hit_points = excluded.max_hit_points, strength = excluded.strength, dexterity = excluded.dexterity`,
+			m.id, m.keywords, m.name, strings.TrimSpace(m.description), wander, m.flags&circleMobStayZone != 0, 5+3*m.level, 6+m.level/2, 6+m.level/2)
+		if err != nil {
+			return nil, fmt.Errorf("writing mobile %d: %v", m.id, err)
+		}
+		counts["mobile"]++
+	}
+
+	// Exits go in once every room they could lead to is there
+	for _, r := range a.rooms {
+		if _, err := tx.Exec("DELETE FROM exits WHERE from_room_id = ?", r.id); err != nil {
+			return nil, fmt.Errorf("clearing exits of room %d: %v", r.id, err)
+		}
+		for _, e := range r.exits {
+			if e.to < 0 {
+				continue
+			}
+			if exists, err := rowExists(tx, "rooms", e.to); err != nil {
+				return nil, fmt.Errorf("checking room %d: %v", e.to, err)
+			} else if !exists {
+				warn("exit %s from room %d leads to missing room %d, left out", circleDirs[e.dir], r.id, e.to)
+				continue
+			}
+			state, name, key := "none", "door", sql.NullInt64{}
+			if e.doorFlags != 0 {
+				state = "open"
+				if words := strings.Fields(e.keywords); len(words) > 0 {
+					name = words[0]
+				}
+			}
+			if e.key > 0 {
+				if exists, err := rowExists(tx, "objects", e.key); err != nil {
+					return nil, fmt.Errorf("checking object %d: %v", e.key, err)
+				} else if exists {
+					key = sql.NullInt64{Int64: int64(e.key), Valid: true}
+				} else {
+					warn("key %d for the door %s of room %d is missing", e.key, circleDirs[e.dir], r.id)
+				}
+			}
+			_, err := tx.Exec("INSERT INTO exits (from_room_id, to_room_id, direction, description, door, door_name, key_id, pickproof) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+				r.id, e.to, circleDirs[e.dir], e.description, state, name, key, e.doorFlags == circlePickproof)
+			if err != nil {
+				return nil, fmt.Errorf("writing exit %s of room %d: %v", circleDirs[e.dir], r.id, err)
+			}
+			counts["exit"]++
+		}
+	}
+
+	// Each reset replaces one matching mobile or item already in its room, so importing twice doesn't double them.
+	// Anything else in the zone, like what players dropped, is left alone
+	for _, z := range a.zones {
+		for _, reset := range z.resets {
+			var err error
+			switch reset.command {
+			case 'M', 'O':
+				thing, table := reset.args[0], "mobiles"
+				if reset.command == 'O' {
+					table = "objects"
+				}
+				room := reset.args[2]
+				thingExists, err := rowExists(tx, table, thing)
+				if err != nil {
+					return nil, fmt.Errorf("checking %s %d: %v", table, thing, err)
+				}
+				roomExists, err := rowExists(tx, "rooms", room)
+				if err != nil {
+					return nil, fmt.Errorf("checking room %d: %v", room, err)
+				}
+				if !thingExists || !roomExists {
+					warn("zone %d: can't place %s %d in room %d", z.id, strings.TrimSuffix(table, "s"), thing, room)
+					continue
+				}
+				instances, column := "mobile_instances", "mobile_id"
+				if reset.command == 'O' {
+					instances, column = "items", "object_id"
+				}
+				result, err := tx.Exec(fmt.Sprintf("DELETE FROM %[1]s WHERE id = (SELECT id FROM %[1]s WHERE %[2]s = ? AND room_id = ? ORDER BY id LIMIT 1)", instances, column), thing, room)
+				if err != nil {
+					return nil, fmt.Errorf("zone %d: replacing %s %d in room %d: %v", z.id, strings.TrimSuffix(table, "s"), thing, room, err)
+				}
+				if replaced, _ := result.RowsAffected(); replaced > 0 {
+					counts["replaced"]++
+				}
+				if _, err = tx.Exec(fmt.Sprintf("INSERT INTO %s (%s, room_id) VALUES (?, ?)", instances, column), thing, room); err != nil {
+					return nil, fmt.Errorf("zone %d: placing %s %d in room %d: %v", z.id, strings.TrimSuffix(table, "s"), thing, room, err)
+				}
+			case 'D':
+				room, dir, state := reset.args[0], reset.args[1], reset.args[2]
+				if dir < 0 || dir >= len(circleDirs) || state < 0 || state >= len(circleDoorStates) {
+					warn("zone %d: bad door reset for room %d", z.id, room)
+					continue
+				}
+				_, err = tx.Exec("UPDATE exits SET door = ? WHERE from_room_id = ? AND direction = ? AND door != 'none'", circleDoorStates[state], room, circleDirs[dir])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("zone %d: applying reset: %v", z.id, err)
+			}
+			counts["reset"]++
+		}
+	}
+	return counts, nil
+}
+
+// The 'import-circle' subcommand: add CircleMUD area files to a world database
+func runCircleImport(args []string) int {
+	flags := flag.NewFlagSet("mud import-circle", flag.ContinueOnError)
+	flags.StringVar(&cfg.Database, "db", cfg.Database, "path to the world database")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: mud import-circle [-db world.db] <file.wld|.zon|.obj|.mob>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	area, err := readCircleFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := openWorldDatabase(cfg.Database); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+	var counts map[string]int
+	err = writeTransaction(func(tx *sql.Tx) (err error) {
+		counts, err = area.write(tx, func(format string, a ...interface{}) {
+			fmt.Fprintf(os.Stderr, "warning: "+format+"\n", a...)
+		})
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "importing: %v\n", err)
+		return 1
+	}
+	summary := []string{}
+	for _, what := range []string{"zone", "room", "exit", "object", "mobile", "reset"} {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[what], plural(counts[what], what)))
+	}
+	fmt.Printf("Imported %s\n", strings.Join(summary, ", "))
+	if counts["replaced"] > 0 {
+		fmt.Printf("Replaced %d of the mobiles and items already in those rooms\n", counts["replaced"])
+	}
+	return 0
+}
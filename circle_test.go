@@ -0,0 +1,222 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A reader over a fixture instead of a file
+func newTestCircleReader(path string, text string) *circleReader {
+	return &circleReader{
+		path:  path,
+		lines: strings.Split(strings.TrimPrefix(text, "\n"), "\n"),
+	}
+}
+
+const (
+	testWorld = `
+#12000
+The Village Gate~
+   A rickety wooden gate.
+The road lies to the south.
+~
+120 0 2
+D0
+You see the village green.
+~
+gate~
+1 12005 12001
+D2
+~
+~
+0 -1 3005
+E
+gate~
+It is old.
+~
+S
+#12001
+The Village Green~
+   Grass grows here.
+~
+120 e 1
+D5
+~
+~
+0 -1 12000
+T 3
+S
+$~
+`
+	testZone = `
+#120
+The Little Village~
+12099 30 2
+* the well keeper
+M 0 12010 1 12001 	the old man
+O 0 12005 1 12001
+G 1 12005 1
+D 0 12000 0 2
+S
+$~
+`
+	testObjects = `
+#12005
+key brass~
+a brass key~
+A brass key lies here.~
+~
+18 0 a
+0 0 0 0
+1 5 0
+E
+key brass~
+A small brass key.
+~
+A
+1 1
+#12006
+stone~
+a stone~
+A stone lies here.~
+~
+13 0 a
+0 0 0 0
+1 0 0
+$~
+`
+	testMobiles = `
+#12010
+old man keeper~
+the old man~
+An old man leans on the well.
+~
+He has seen many winters.
+~
+bg 0 500 S
+5 20 8 2d8+20 1d4+0
+10 200
+8 8 1
+#12011
+rat~
+a rat~
+A rat scurries around.
+~
+~
+ab 0 0 E
+1 20 10 1d2+1 1d2+0
+0 10
+8 8 0
+BareHandAttack: 9
+E
+$
+`
+)
+
+func TestCircleReaders(t *testing.T) {
+	a := &circleArea{}
+	if err := a.readWorld(newTestCircleReader("120.wld", testWorld)); err != nil {
+		t.Fatalf("reading rooms: %v", err)
+	}
+	if err := a.readZone(newTestCircleReader("120.zon", testZone)); err != nil {
+		t.Fatalf("reading zone: %v", err)
+	}
+	if err := a.readObjects(newTestCircleReader("120.obj", testObjects)); err != nil {
+		t.Fatalf("reading objects: %v", err)
+	}
+	if err := a.readMobiles(newTestCircleReader("120.mob", testMobiles)); err != nil {
+		t.Fatalf("reading mobiles: %v", err)
+	}
+
+	want := &circleArea{
+		zones: []circleZone{{
+			id:   120,
+			name: "The Little Village",
+			// The G reset is skipped
+			resets: []circleReset{
+				{command: 'M', args: []int{12010, 1, 12001}},
+				{command: 'O', args: []int{12005, 1, 12001}},
+				{command: 'D', args: []int{12000, 0, 2}},
+			},
+		}},
+		rooms: []circleRoom{
+			{
+				id:          12000,
+				zone:        120,
+				name:        "The Village Gate",
+				description: "   A rickety wooden gate.\nThe road lies to the south.\n",
+				exits: []circleExit{
+					{dir: 0, description: "You see the village green.\n", keywords: "gate", doorFlags: 1, key: 12005, to: 12001},
+					{dir: 2, key: -1, to: 3005},
+				},
+			},
+			{
+				id:          12001,
+				zone:        120,
+				name:        "The Village Green",
+				description: "   Grass grows here.\n",
+				flags:       circleRoomPeaceful,
+				exits:       []circleExit{{dir: 5, key: -1, to: 12000}},
+			},
+		},
+		objects: []circleObject{
+			{id: 12005, keywords: "key brass", name: "a brass key", ground: "A brass key lies here.", description: "A small brass key.\n"},
+			// Without an extra description, examining shows the ground text
+			{id: 12006, keywords: "stone", name: "a stone", ground: "A stone lies here.", description: "A stone lies here."},
+		},
+		mobiles: []circleMobile{
+			{id: 12010, keywords: "old man keeper", name: "the old man", description: "He has seen many winters.\n", flags: circleMobSentinel | circleMobStayZone, level: 5},
+			// Without a detailed description, the long one is used
+			{id: 12011, keywords: "rat", name: "a rat", description: "A rat scurries around.\n", flags: 1 | circleMobSentinel, level: 1},
+		},
+	}
+	if !reflect.DeepEqual(a, want) {
+		t.Fatalf("read\n%+v\nwant\n%+v", a, want)
+	}
+}
+
+func TestCircleReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		read func(*circleArea, *circleReader) error
+		text string
+		err  string
+	}{
+		{"no vnum", (*circleArea).readWorld, "12000\nA room~\n", "expected #<vnum>"},
+		{"unfinished string", (*circleArea).readWorld, "#12000\nA room~\nIt goes on\n", "missing '~'"},
+		{"no zone", (*circleArea).readWorld, "#12000\nA room~\n~\n0\nS\n", "expected zone and flags"},
+		{"no end", (*circleArea).readWorld, "#12000\nA room~\n~\n120 0 0\n", "missing 'S'"},
+		{"bad exit", (*circleArea).readWorld, "#12000\nA room~\n~\n120 0 0\nD9\n~\n~\n0 0 1\nS\n", "bad exit"},
+		{"short exit", (*circleArea).readWorld, "#12000\nA room~\n~\n120 0 0\nD1\n~\n~\n0 0\nS\n", "expected 3 numbers"},
+		{"bad reset", (*circleArea).readZone, "#120\nZone~\n12099 30 2\nM 0 x 1 12001\nS\n", "bad reset"},
+		{"short object", (*circleArea).readObjects, "#12005\nkey~\na key~\nA key.~\n~\n18 0 a\n", "unexpected end of file"},
+		{"no level", (*circleArea).readMobiles, "#12010\nman~\nthe man~\nA man.\n~\n~\nb 0 0 S\nlevel\n", "expected a number"},
+		{"unfinished mobile", (*circleArea).readMobiles, "#12010\nman~\nthe man~\nA man.\n~\n~\nb 0 0 E\n1 2 3\n0 0\n8 8 0\n", "missing 'E'"},
+	}
+	for _, test := range tests {
+		err := test.read(&circleArea{}, newTestCircleReader("area", test.text))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want one about %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestCircleFlags(t *testing.T) {
+	tests := []struct {
+		field string
+		bits  int
+	}{
+		{"0", 0},
+		{"18", 18},
+		{"a", 1},
+		{"bg", circleMobSentinel | circleMobStayZone},
+		{"e", circleRoomPeaceful},
+		{"A", 1 << 26},
+	}
+	for _, test := range tests {
+		if bits := circleFlags(test.field); bits != test.bits {
+			t.Errorf("circleFlags(%q) = %d, want %d", test.field, bits, test.bits)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Room flags
+const (
+	roomPeaceful roomFlag = 1 << iota // No fighting allowed
+)
+
+const (
+	combatRound     = 2 * time.Second  // Time between attacks in a fight
+	regenInterval   = 10 * time.Second // How often the wounded heal
+	mobRespawnDelay = 5 * time.Minute  // How long killed mobiles stay dead
+	fleeChance      = 60               // Percent chance to get away
+)
+
+var (
+	roomFlagNames = map[string]roomFlag{
+		"peaceful": roomPeaceful,
+	}
+	startingStats = stats{hp: 20, maxHP: 20, strength: 10, dexterity: 10}
+	fighters      []combatant // Everyone in a fight, in the order they joined it
+)
+
+// Anything that can fight: players and mobiles
+type combatant interface {
+	fighterName() string // How the combatant is named in messages
+	fighterStats() *stats
+	fighterRoom() *room
+	opponent() combatant
+	setOpponent(c combatant)
+	attackVerb() string
+	die(killer combatant)
+}
+
+func (p *player) fighterName() string     { return p.name }
+func (p *player) fighterStats() *stats    { return &p.stats }
+func (p *player) fighterRoom() *room      { return p.room }
+func (p *player) opponent() combatant     { return p.fighting }
+func (p *player) setOpponent(c combatant) { p.fighting = c }
+func (p *player) attackVerb() string      { return "hit" }
+
+func (m *mob) fighterName() string     { return m.mobile.name }
+func (m *mob) fighterStats() *stats    { return &m.stats }
+func (m *mob) fighterRoom() *room      { return m.room }
+func (m *mob) opponent() combatant     { return m.fighting }
+func (m *mob) setOpponent(c combatant) { m.fighting = c }
+func (m *mob) attackVerb() string      { return m.mobile.attack }
+
+// Parse space separated flag names from the database, ignoring unknown ones
+func parseRoomFlags(s string) roomFlag {
+	var flags roomFlag
+	for _, name := range strings.Fields(strings.ToLower(s)) {
+		flags |= roomFlagNames[name]
+	}
+	return flags
+}
+
+// Whether the room has a flag set
+func (r *room) has(flag roomFlag) bool {
+	return r.flags&flag != 0
+}
+
+// Put two combatants in a fight with each other, unless they are already busy
+func startFight(a, b combatant) {
+	if a.opponent() == nil {
+		a.setOpponent(b)
+		fighters = append(fighters, a)
+	}
+	if b.opponent() == nil {
+		b.setOpponent(a)
+		fighters = append(fighters, b)
+	}
+}
+
+// Take one combatant out of the fight
+func disengage(c combatant) {
+	c.setOpponent(nil)
+	if i := index(len(fighters), func(idx int) bool { return fighters[idx] == c }); i != -1 {
+		fighters = append(fighters[:i], fighters[i+1:]...)
+	}
+}
+
+// End every fight involving a combatant, e.g. when it leaves the room or dies.
+// Anyone left being attacked turns on their attacker
+func stopFighting(c combatant) {
+	disengage(c)
+	for _, f := range append([]combatant(nil), fighters...) {
+		if f.opponent() == c {
+			disengage(f)
+		}
+	}
+	for _, f := range fighters {
+		if o := f.opponent(); o.opponent() == nil {
+			startFight(o, f)
+		}
+	}
+}
+
+// Everyone in a fight gets one attack
+func fightRound() {
+	for _, a := range append([]combatant(nil), fighters...) {
+		b := a.opponent()
+		if b == nil {
+			// Their fight ended earlier in the round
+			continue
+		}
+		if b.fighterRoom() != a.fighterRoom() {
+			disengage(a)
+			continue
+		}
+		attack(a, b)
+	}
+}
+
+// Swing once, for better or worse
+func attack(a, b combatant) {
+	as, bs := a.fighterStats(), b.fighterStats()
+	chance := 60 + 5*(as.dexterity-bs.dexterity)
+	if chance < 5 {
+		chance = 5
+	} else if chance > 95 {
+		chance = 95
+	}
+	verb := a.attackVerb()
+	if rand.Intn(100) >= chance {
+		fightMessage(a, b,
+			fmt.Sprintf("You try to %s %s, but miss.", verb, b.fighterName()),
+			fmt.Sprintf("%s tries to %s you, but misses.", capitalize(a.fighterName()), verb),
+			fmt.Sprintf("%s tries to %s %s, but misses.", capitalize(a.fighterName()), verb, b.fighterName()),
+		)
+		return
+	}
+	damage := 1 + rand.Intn(as.strength/2+1)
+	bs.hp -= damage
+	fightMessage(a, b,
+		fmt.Sprintf("You %s %s. [%d]", verb, b.fighterName(), damage),
+		fmt.Sprintf("%s %ss you. [%d]", capitalize(a.fighterName()), verb, damage),
+		fmt.Sprintf("%s %ss %s.", capitalize(a.fighterName()), verb, b.fighterName()),
+	)
+	if bs.hp <= 0 {
+		b.fighterRoom().announce(commands["kill"], fmt.Sprintf("%s is dead! R.I.P.", capitalize(b.fighterName())))
+		stopFighting(b)
+		b.die(a)
+	}
+}
+
+// Describe an attack to the attacker, the victim and everyone else in the room
+func fightMessage(a, b combatant, toAttacker, toVictim, toRoom string) {
+	for _, p := range a.fighterRoom().players {
+		msg := toRoom
+		switch combatant(p) {
+		case a:
+			msg = toAttacker
+		case b:
+			msg = ansiWrap(toVictim, colorHurt)
+		}
+		p.send(event{
+			output:  msg,
+			command: commands["kill"],
+		})
+	}
+}
+
+// Players wake up at the recall point with their wounds healed
+func (p *player) die(_ combatant) {
+	p.stats.hp = p.stats.maxHP
+	p.send(event{
+		player: p,
+		output: ansiWrap("You have been killed! You wake up somewhere familiar...", colorHurt),
+	})
+	p.moveToRoom(rooms[cfg.RecallRoom])
+}
+
+// Mobiles are gone for a while, then come back at home
+func (m *mob) die(_ combatant) {
+	m.room.removeMob(m)
+	if i := index(len(mobs), func(idx int) bool { return mobs[idx] == m }); i != -1 {
+		mobs = append(mobs[:i], mobs[i+1:]...)
+	}
+	sched.after(mobRespawnDelay, m.respawn)
+}
+
+func (m *mob) respawn() {
+	m.stats.hp = m.stats.maxHP
+	// The world may have been reloaded while it was gone
+	m.home = relocate(m.home)
+	m.room = m.home
+	m.room.mobs = append(m.room.mobs, m)
+	mobs = append(mobs, m)
+	m.room.announce(nil, fmt.Sprintf("%s has arrived.", capitalize(m.mobile.name)))
+}
+
+// Heal a little when not fighting
+func regenerate() {
+	heal := func(c combatant) {
+		s := c.fighterStats()
+		if c.opponent() == nil && s.hp < s.maxHP {
+			s.hp += 1 + s.maxHP/10
+			if s.hp > s.maxHP {
+				s.hp = s.maxHP
+			}
+		}
+	}
+	for _, p := range players {
+		heal(p)
+	}
+	for _, m := range mobs {
+		heal(m)
+	}
+}
+
+// Combat
+
+// Start a fight with a player or mobile in the room
+func (p *player) doKill(cmd string) {
+	words := strings.Fields(cmd)
+	if len(words) != 1 {
+		p.send(event{
+			player: p,
+			output: "Usage: kill <player|mobile>",
+			err:    true,
+		})
+		return
+	}
+	var target combatant
+	if idx := index(len(p.room.players), func(i int) bool { return strings.EqualFold(p.room.players[i].name, words[0]) }); idx != -1 {
+		target = p.room.players[idx]
+	} else if m := p.room.findMob(words[0]); m != nil {
+		target = m
+	}
+	switch {
+	case target == nil:
+		p.send(event{
+			player: p,
+			output: "They aren't here.",
+			err:    true,
+		})
+	case target == combatant(p):
+		p.send(event{
+			player: p,
+			output: "You hit yourself. Ouch!",
+		})
+	case p.room.has(roomPeaceful):
+		p.send(event{
+			player: p,
+			output: "You feel too peaceful to fight here.",
+		})
+	case p.fighting != nil:
+		p.send(event{
+			player: p,
+			output: "You are already fighting!",
+		})
+	default:
+		p.roomCommand(
+			commands["kill"],
+			fmt.Sprintf("%s attacks %s!", p.name, target.fighterName()),
+			fmt.Sprintf("You attack %s!", target.fighterName()),
+		)
+		startFight(p, target)
+	}
+}
+
+// Run through a random open exit
+func (p *player) doFlee(_ string) {
+	if p.fighting == nil {
+		p.send(event{
+			player: p,
+			output: "You aren't fighting anyone.",
+		})
+		return
+	}
+	choices := []int{}
+	for dir, exit := range p.room.exits {
+		if exit.to != nil && !exit.blocked() {
+			choices = append(choices, dir)
+		}
+	}
+	if len(choices) == 0 || rand.Intn(100) >= fleeChance {
+		p.send(event{
+			player: p,
+			output: "PANIC! You couldn't escape!",
+		})
+		return
+	}
+	p.roomCommand(
+		commands["flee"],
+		fmt.Sprintf("%s panics, and attempts to flee!", p.name),
+		"You flee head over heels.",
+	)
+	p.moveToRoom(p.room.exits[choices[rand.Intn(len(choices))]].to)
+}
+
+// Show hit points and abilities
+func (p *player) doScore(_ string) {
+	fighting := "nobody"
+	if p.fighting != nil {
+		fighting = p.fighting.fighterName()
+	}
+	p.send(event{
+		player: p,
+		output: fmt.Sprintf("Hit points: %d/%d\nStrength:   %d\nDexterity:  %d\nFighting:   %s",
+			p.stats.hp, p.stats.maxHP, p.stats.strength, p.stats.dexterity, fighting),
+	})
+}
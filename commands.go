@@ -11,9 +11,13 @@ import (
 const (
 	nav commandCategory = iota
 	info
+	gear
+	fight
 	comm
 	emotes
 	special
+	build
+	admin
 )
 
 var (
@@ -22,6 +26,16 @@ var (
 	dirs               map[string]string          // Direction abbreviations
 	dirRuneToInt       map[rune]int               // Maps the exit direction string to its place in the room exit array
 	dirIntToRune       map[int]rune               // Maps a place in the room exit array to a direction abbreviation rune
+
+	// Abbreviations that always mean the same command, whatever is added before or after it
+	reservedPrefixes = map[string]string{
+		"g":  "gossip",
+		"l":  "look",
+		"p":  "poke",
+		"s":  "south",
+		"sc": "scowl",
+		"t":  "tell",
+	}
 )
 
 // Initialize and populate lookup tables
@@ -56,20 +70,13 @@ func createMaps() {
 	commandCategoryMap = make(map[commandCategory]string)
 	commandCategoryMap[nav] = "navigation"
 	commandCategoryMap[info] = "information"
+	commandCategoryMap[gear] = "items"
+	commandCategoryMap[fight] = "combat"
 	commandCategoryMap[comm] = "communication"
 	commandCategoryMap[emotes] = "emotes"
 	commandCategoryMap[special] = "special"
-
-	// ANSI colors map
-	ansiColors = make(map[string]string)
-	ansiColors["black"] = "\x1b[30m"
-	ansiColors["red"] = "\x1b[31m"
-	ansiColors["green"] = "\x1b[32m"
-	ansiColors["yellow"] = "\x1b[33m"
-	ansiColors["blue"] = "\x1b[34m"
-	ansiColors["magenta"] = "\x1b[35m"
-	ansiColors["cyan"] = "\x1b[36m"
-	ansiColors["white"] = "\x1b[37m"
+	commandCategoryMap[build] = "building"
+	commandCategoryMap[admin] = "administration"
 }
 
 /* Maps prefixes to full name for a map */
@@ -132,7 +139,7 @@ func defaultCommands() {
 	addCommand("recall", command{
 		name:        "recall",
 		category:    nav,
-		description: "Return to the Temple of Midgaard",
+		description: "Return to the recall point (Temple of Midgaard)",
 		run:         (*player).doRecall,
 	})
 	// Information
@@ -148,6 +155,12 @@ func defaultCommands() {
 		description: "Display names and locations of all players in current zone",
 		run:         (*player).doWhere,
 	})
+	addCommand("map", command{
+		name:        "map",
+		category:    info,
+		description: "Draw the whole zone, or another visited zone by name",
+		run:         (*player).doMap,
+	})
 	addCommand("help", command{
 		name:        "help",
 		category:    info,
@@ -179,6 +192,47 @@ func defaultCommands() {
 		description: "Speak privately to a specific player",
 		run:         (*player).doTell,
 	})
+	// Items
+	c := command{
+		name:        "get",
+		category:    gear,
+		description: "Pick up an item, or all of them",
+		run:         (*player).doGet,
+	}
+	addCommand("get", c)
+	addCommand("take", c)
+	addCommand("drop", command{
+		name:        "drop",
+		category:    gear,
+		description: "Put down an item, or everything you carry",
+		run:         (*player).doDrop,
+	})
+	addCommand("give", command{
+		name:        "give",
+		category:    gear,
+		description: "Hand an item to a player in the room",
+		run:         (*player).doGive,
+	})
+	c = command{
+		name:        "inventory",
+		category:    gear,
+		description: "List what you are carrying",
+		run:         (*player).doInventory,
+	}
+	addCommand("inventory", c)
+	addCommand("i", c)
+	addCommand("examine", command{
+		name:        "examine",
+		category:    gear,
+		description: "Look closely at an item or a mobile",
+		run:         (*player).doExamine,
+	})
+	addCommand("time", command{
+		name:        "time",
+		category:    info,
+		description: "See what time it is in the game",
+		run:         (*player).doTime,
+	})
 	// Emotes
 	addCommand("poke", command{
 		name:        "poke",
@@ -216,8 +270,83 @@ func defaultCommands() {
 		description: "Put on your thinking cap",
 		run:         (*player).doThink,
 	})
+	// Doors
+	addCommand("open", command{
+		name:        "open",
+		category:    nav,
+		description: "Open a door",
+		run:         (*player).doOpen,
+	})
+	addCommand("close", command{
+		name:        "close",
+		category:    nav,
+		description: "Close a door",
+		run:         (*player).doClose,
+	})
+	addCommand("lock", command{
+		name:        "lock",
+		category:    nav,
+		description: "Lock a door with its key",
+		run:         (*player).doLock,
+	})
+	addCommand("unlock", command{
+		name:        "unlock",
+		category:    nav,
+		description: "Unlock a door with its key",
+		run:         (*player).doUnlock,
+	})
+	addCommand("pick", command{
+		name:        "pick",
+		category:    nav,
+		description: "Try to unlock a door without its key",
+		run:         (*player).doPick,
+	})
+	// Combat
+	addCommand("kill", command{
+		name:        "kill",
+		category:    fight,
+		description: "Attack a player or a mobile",
+		run:         (*player).doKill,
+	})
+	addCommand("flee", command{
+		name:        "flee",
+		category:    fight,
+		description: "Try to run away from a fight",
+		run:         (*player).doFlee,
+	})
+	addCommand("score", command{
+		name:        "score",
+		category:    fight,
+		description: "Show your hit points and abilities",
+		run:         (*player).doScore,
+	})
+	// Travel
+	addCommand("travel", command{
+		name:        "travel",
+		category:    nav,
+		description: "Walk to a bookmark or a visited room by name",
+		run:         (*player).doTravel,
+	})
+	addCommand("bookmark", command{
+		name:        "bookmark",
+		category:    nav,
+		description: "Name the current room to travel back to, or list bookmarks",
+		run:         (*player).doBookmark,
+	})
 	// Special
-	c := command{
+	addCommand("set", command{
+		name:        "set",
+		category:    special,
+		description: "List or change your settings",
+		run:         (*player).doSet,
+	})
+	addCommand("color", command{
+		name:        "color",
+		category:    special,
+		description: "List or change the colors of each kind of output",
+		run:         (*player).doColor,
+	})
+	c = command{
 		name:        "quit",
 		category:    special,
 		description: "Leave the MUD",
@@ -225,10 +354,69 @@ func defaultCommands() {
 	}
 	addCommand("quit", c)
 	addCommand("exit", c)
+	// Building
+	// Added last so that no prefixes are taken from everyday commands
+	addCommand("room", command{
+		name:        "room",
+		category:    build,
+		description: "Create, rename or describe rooms",
+		run:         (*player).doRoom,
+		rank:        rankBuilder,
+	})
+	addCommand("zone", command{
+		name:        "zone",
+		category:    build,
+		description: "Create a zone",
+		run:         (*player).doZone,
+		rank:        rankBuilder,
+	})
+	addCommand("dig", command{
+		name:        "dig",
+		category:    build,
+		description: "Make a new room in a direction",
+		run:         (*player).doDig,
+		rank:        rankBuilder,
+	})
+	addCommand("link", command{
+		name:        "link",
+		category:    build,
+		description: "Add an exit to an existing room",
+		run:         (*player).doLink,
+		rank:        rankBuilder,
+	})
+	addCommand("unlink", command{
+		name:        "unlink",
+		category:    build,
+		description: "Remove an exit",
+		run:         (*player).doUnlink,
+		rank:        rankBuilder,
+	})
+	// Administration
+	addCommand("promote", command{
+		name:        "promote",
+		category:    admin,
+		description: "Change a player's rank",
+		run:         (*player).doPromote,
+		rank:        rankAdmin,
+	})
+	addCommand("reload", command{
+		name:        "reload",
+		category:    admin,
+		description: "Reload zones, rooms and exits from the database",
+		run:         (*player).doReload,
+		rank:        rankAdmin,
+	})
+	addCommand("mapimage", command{
+		name:        "mapimage",
+		category:    admin,
+		description: "Draw a zone to an SVG or PNG file on the server",
+		run:         (*player).doMapImage,
+		rank:        rankAdmin,
+	})
 }
 
 /* Auto adds all prefixes of alias.
-Will not overwrite existing alias mappings.
+Will not overwrite existing alias mappings, or take reserved prefixes meant for another command.
 Add commands in order of importance for alias precedence. */
 func addCommand(alias string, cmd command) {
 	for i := range alias {
@@ -236,7 +424,8 @@ func addCommand(alias string, cmd command) {
 			continue
 		}
 		prefix := alias[:i]
-		if _, exists := commands[prefix]; !exists {
+		owner, reserved := reservedPrefixes[prefix]
+		if _, exists := commands[prefix]; (!exists && !reserved) || owner == alias {
 			commands[prefix] = &cmd
 		}
 	}
@@ -250,13 +439,14 @@ func addCommand(alias string, cmd command) {
 // Navigation
 
 func (p *player) doRecall(_ string) {
-	p.events <- event{
+	r := rooms[cfg.RecallRoom]
+	p.send(event{
 		player:  p,
-		output:  "\nYou head back to the Temple of Midgard...\n",
+		output:  fmt.Sprintf("\nYou head back to the %s...\n", r.name),
 		command: commands["recall"],
 		delay:   1000,
-	}
-	p.moveToRoom(rooms[3001])
+	})
+	p.moveToRoom(r)
 }
 
 // Navigation
@@ -282,17 +472,25 @@ func (p *player) doDown(_ string) {
 
 // Make sure it is a valid direction
 func (p *player) moveDirection(dir int) {
-	if exit := p.room.exits[dir]; exit.to != nil {
+	if exit := p.room.exits[dir]; exit.visible() && exit.blocked() {
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("The %s is closed.", exit.door.name),
+		})
+	} else if exit.to != nil && !exit.blocked() {
 		p.moveToRoom(exit.to)
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "You can't go that way...",
-		}
+		})
 	}
 }
 
 func (p *player) moveToRoom(r *room) {
+	// Leaving the room ends any fight
+	stopFighting(p)
+
 	//  Remove from old room/zone
 	p.room.removePlayer(p)
 	p.zone.removePlayer(p)
@@ -300,19 +498,19 @@ func (p *player) moveToRoom(r *room) {
 	// Notify other players in old room
 	for _, other := range p.room.players {
 		if other != p {
-			other.events <- event{
+			other.send(event{
 				player: p,
 				output: fmt.Sprintf("%s has left the room", p.name),
-			}
+			})
 		}
 	}
 
 	// Notify other players in new room
 	for _, other := range r.players {
-		other.events <- event{
+		other.send(event{
 			player: p,
 			output: fmt.Sprintf("%s has entered the room", p.name),
-		}
+		})
 	}
 
 	p.room = r
@@ -323,11 +521,12 @@ func (p *player) moveToRoom(r *room) {
 	p.room.sortPlayers()
 
 	// Update map
-	p.events <- event{
-		player:    p,
-		output:    "",
-		updateMap: true,
-	}
+	p.visited[p.room.id] = true
+	p.send(event{
+		player:  p,
+		output:  "",
+		minimap: p.minimap.snapshot(p.room, p.visited),
+	})
 
 	p.printLocation()
 
@@ -342,26 +541,45 @@ func (p *player) doLook(direction string) {
 		if fullDir, exists := dirs[direction]; exists {
 			p.lookDirection(fullDir)
 		} else {
-			p.events <- event{
+			p.send(event{
 				player: p,
 				output: "Usage: look <north|south|east|west|up|down>",
 				err:    true,
-			}
+			})
 		}
 	}
 }
 
 // Prints current room description and available exits
 func (p *player) printLocation() {
+	p.send(event{
+		player: p,
+		output: p.describeLocation(),
+	})
+}
+
+// The current room as the player sees it, with its exits and who and what is there
+func (p *player) describeLocation() string {
 	output := ""
 	output += (p.room.name + "\n\n")
 	output += p.room.description
+	if p.room.description != "" && !strings.HasSuffix(p.room.description, "\n") {
+		// Descriptions written before they were stored with a newline
+		output += "\n"
+	}
+	// Show what is lying around
+	for _, line := range groundItems(p.room.items) {
+		output += ansiWrap(line, colorItem) + "\n"
+	}
 
 	// Show exits
 	output += "\nEXITS: [ "
 	for i, exit := range p.room.exits {
-		if exit.to != nil {
-			output += fmt.Sprintf("%s ", ansiWrap(string(dirIntToRune[i]), ansiColors["cyan"]))
+		if exit.blocked() && exit.visible() {
+			// Closed doors are shown in parentheses
+			output += fmt.Sprintf("(%s) ", ansiWrap(string(dirIntToRune[i]), colorDoor))
+		} else if exit.visible() {
+			output += fmt.Sprintf("%s ", ansiWrap(string(dirIntToRune[i]), colorExit))
 		}
 	}
 	output += "]\n\n"
@@ -369,28 +587,50 @@ func (p *player) printLocation() {
 	output += "PLAYERS: [ "
 	for _, other := range p.room.players {
 		if other != p {
-			output += fmt.Sprintf("%s ", ansiWrap(other.name, ansiColors["yellow"]))
+			output += fmt.Sprintf("%s ", ansiWrap(other.name, colorPlayer))
 		}
 	}
-	output += "]"
-	// Send formatted output to player
-	p.events <- event{
-		player: p,
-		output: output,
+	output += "]\n\n"
+	// Show mobiles
+	// Show mobiles
+	mobNames := []string{}
+	for _, m := range p.room.mobs {
+		mobNames = append(mobNames, ansiWrap(m.mobile.name, colorMobile))
+	}
+	output += "NPCS: " + bracketList(mobNames) + "\n\n"
+	// Show items
+	itemNames := []string{}
+	for _, name := range listItems(p.room.items) {
+		itemNames = append(itemNames, ansiWrap(name, colorItem))
+	}
+	output += "ITEMS: " + bracketList(itemNames)
+	return output
+}
+
+// List names in brackets, e.g. "[ the high priest, the cityguard ]".
+// Names of several words are told apart by the commas, which still works without colors
+func bracketList(names []string) string {
+	if len(names) == 0 {
+		return "[ ]"
 	}
+	return "[ " + strings.Join(names, ", ") + " ]"
 }
 
 func (p *player) lookDirection(dir string) {
-	if exit := p.room.exits[dirRuneToInt[rune(strings.ToLower(dir)[0])]]; exit.to != nil {
-		p.events <- event{
-			player: p,
-			output: strings.TrimSuffix(exit.description, "\n"),
+	if exit := p.room.exits[dirRuneToInt[rune(strings.ToLower(dir)[0])]]; exit.visible() {
+		output := strings.TrimSuffix(exit.description, "\n")
+		if exit.blocked() {
+			output += fmt.Sprintf("\nThe %s is closed.", exit.door.name)
 		}
+		p.send(event{
+			player: p,
+			output: strings.TrimPrefix(output, "\n"),
+		})
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "There's nothing there...",
-		}
+		})
 	}
 }
 
@@ -405,18 +645,18 @@ func (p *player) doWhere(_ string) {
 
 	for _, other := range p.zone.players {
 		if other != p {
-			output += fmt.Sprintf("|%s|%s|\n", ansiWrap(centerText(other.name, 20, ' '), ansiColors["yellow"]), centerText(other.room.name, 40, ' '))
+			output += fmt.Sprintf("|%s|%s|\n", ansiWrap(centerText(other.name, 20, ' '), colorPlayer), centerText(other.room.name, 40, ' '))
 		} else {
-			output += fmt.Sprintf("|%s|%s|\n", ansiWrap(centerText(p.name, 20, ' '), ansiColors["green"]), centerText(other.room.name, 40, ' '))
+			output += fmt.Sprintf("|%s|%s|\n", ansiWrap(centerText(p.name, 20, ' '), colorYou), centerText(other.room.name, 40, ' '))
 		}
 	}
 
 	output += fmt.Sprintf("+%s+", strings.Repeat("-", 61))
 	// Send formatted output to player
-	p.events <- event{
+	p.send(event{
 		player: p,
 		output: output,
-	}
+	})
 }
 
 // Lists known aliases for commands
@@ -432,6 +672,10 @@ func (p *player) doListCommands(_ string) {
 	categoryMap := make(map[commandCategory]map[string][]string)
 
 	for alias, cmd := range commands {
+		// Only show what the player may use
+		if cmd.rank > p.rank {
+			continue
+		}
 		if _, exists := categoryMap[cmd.category]; !exists {
 			categoryMap[cmd.category] = make(map[string][]string)
 		}
@@ -500,18 +744,28 @@ func (p *player) doListCommands(_ string) {
 		}
 		output += fmt.Sprintf("+%s+", strings.Repeat("-", 30))
 	}
+	output += "\n\nSpeedwalk: type several directions on one line, like '3n2e u w', to take them in turn." +
+		"\nA single word without numbers is read as a command, so start it with '.' to walk it, like '.nnee'."
 	// Send formatted output to player
-	p.events <- event{
+	p.send(event{
 		player: p,
 		output: output,
-	}
+	})
+}
+
+// Tell the time of day in the game
+func (p *player) doTime(_ string) {
+	p.send(event{
+		player: p,
+		output: fmt.Sprintf("It is %s.", describeGameTime()),
+	})
 }
 
 // Communication
 
 // Speak to all players on server
 func (p *player) doGossip(msg string) {
-	msg = ansiWrap(msg, ansiColors["yellow"])
+	msg = ansiWrap(msg, colorChannel)
 	p.serverCommand(
 		commands["gossip"],
 		fmt.Sprintf("%s gossips: %s", p.name, msg),
@@ -521,7 +775,7 @@ func (p *player) doGossip(msg string) {
 
 // Speak to all players in a zone
 func (p *player) doShout(msg string) {
-	msg = ansiWrap(msg, ansiColors["yellow"])
+	msg = ansiWrap(msg, colorChannel)
 	p.zoneCommand(
 		commands["shout"],
 		fmt.Sprintf("%s shouts: %s", p.name, msg),
@@ -531,12 +785,14 @@ func (p *player) doShout(msg string) {
 
 // Speak to all players in a room
 func (p *player) doSay(msg string) {
-	msg = ansiWrap(msg, ansiColors["yellow"])
+	said := msg
+	msg = ansiWrap(msg, colorChannel)
 	p.roomCommand(
 		commands["say"],
 		fmt.Sprintf("%s says: %s", p.name, msg),
 		fmt.Sprintf("You say: %s", msg),
 	)
+	p.room.hearSay(p, said)
 }
 
 // Sends a message to specific player, regardless of where they are
@@ -552,11 +808,11 @@ func (p *player) doTell(cmd string) {
 			"You know talking to yourself is a sign of insanity, right?",
 		)
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "Usage: tell <player name> <Message>",
 			err:    true,
-		}
+		})
 	}
 }
 
@@ -571,11 +827,11 @@ func (p *player) doPoke(cmd string) {
 			"Why are you poking yourself...",
 		)
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "Usage: poke <?player name>",
 			err:    true,
-		}
+		})
 	}
 }
 
@@ -598,11 +854,11 @@ func (p *player) doSmile(cmd string) {
 			"You smile ... at yourself?",
 		)
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "Usage: smile <?player name>",
 			err:    true,
-		}
+		})
 
 	}
 }
@@ -624,11 +880,11 @@ func (p *player) doScowl(cmd string) {
 			"You must really hate yourself...",
 		)
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "Usage: scowl <?player name>",
 			err:    true,
-		}
+		})
 	}
 }
 
@@ -649,11 +905,11 @@ func (p *player) doSigh(cmd string) {
 			"Rough day, huh?",
 		)
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "Usage: sigh <?player name>",
 			err:    true,
-		}
+		})
 	}
 }
 
@@ -674,11 +930,11 @@ func (p *player) doLaugh(cmd string) {
 			"It's always good to be able to laugh at yourself",
 		)
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "Usage: laugh <?player name>",
 			err:    true,
-		}
+		})
 	}
 }
 
@@ -690,11 +946,11 @@ func (p *player) doThink(cmd string) {
 			"You are in deep thought",
 		)
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "Usage: think",
 			err:    true,
-		}
+		})
 	}
 }
 
@@ -707,34 +963,41 @@ func (p *player) doQuit(_ string) {
 
 // Helper functions
 
-// Represents a command that targets another player in the room
+// Represents a command that targets another player or a mobile in the room
 func (p *player) targetedRoomCommand(cmd *command, name string, outMsg string, selfMsg string, errSelf string) {
 	if idx := index(len(p.room.players), func(i int) bool { return p.room.players[i].name == name }); idx != -1 {
 		other := p.room.players[idx]
 		if other != p {
-			other.events <- event{
+			other.send(event{
 				player:  p,
 				output:  outMsg,
 				command: cmd,
-			}
-			p.events <- event{
+			})
+			p.send(event{
 				player:  p,
 				output:  selfMsg,
 				command: cmd,
-			}
+			})
 		} else {
-			p.events <- event{
+			p.send(event{
 				player:  p,
 				output:  errSelf,
 				command: cmd,
-			}
+			})
 		}
+	} else if m := p.room.findMob(name); m != nil {
+		p.send(event{
+			player:  p,
+			output:  selfMsg,
+			command: cmd,
+		})
+		m.react(cmd, p)
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "No such player in this room!",
 			err:    true,
-		}
+		})
 	}
 }
 
@@ -742,29 +1005,29 @@ func (p *player) targetedRoomCommand(cmd *command, name string, outMsg string, s
 func (p *player) targetedServerCommand(cmd *command, name string, outMsg string, selfMsg string, errSelf string) {
 	if other, exists := players[name]; exists {
 		if other != p {
-			other.events <- event{
+			other.send(event{
 				player:  p,
 				output:  outMsg,
 				command: cmd,
-			}
-			p.events <- event{
+			})
+			p.send(event{
 				player:  p,
 				output:  selfMsg,
 				command: cmd,
-			}
+			})
 		} else {
-			p.events <- event{
+			p.send(event{
 				player:  p,
 				output:  errSelf,
 				command: cmd,
-			}
+			})
 		}
 	} else {
-		p.events <- event{
+		p.send(event{
 			player: p,
 			output: "No such player!",
 			err:    true,
-		}
+		})
 	}
 }
 
@@ -772,19 +1035,17 @@ func (p *player) targetedServerCommand(cmd *command, name string, outMsg string,
 func (p *player) roomCommand(cmd *command, outMsg string, selfMsg string) {
 	for _, other := range p.room.players {
 		if other != p {
-			if ch := other.events; ch != nil {
-				ch <- event{
-					player:  p,
-					output:  outMsg,
-					command: cmd,
-				}
-			}
+			other.send(event{
+				player:  p,
+				output:  outMsg,
+				command: cmd,
+			})
 		} else {
-			p.events <- event{
+			p.send(event{
 				player:  p,
 				output:  selfMsg,
 				command: cmd,
-			}
+			})
 		}
 	}
 }
@@ -793,19 +1054,17 @@ func (p *player) roomCommand(cmd *command, outMsg string, selfMsg string) {
 func (p *player) zoneCommand(cmd *command, outMsg string, selfMsg string) {
 	for _, other := range p.zone.players {
 		if other != p {
-			if ch := other.events; ch != nil {
-				ch <- event{
-					player:  p,
-					output:  outMsg,
-					command: cmd,
-				}
-			}
+			other.send(event{
+				player:  p,
+				output:  outMsg,
+				command: cmd,
+			})
 		} else {
-			p.events <- event{
+			p.send(event{
 				player:  p,
 				output:  selfMsg,
 				command: cmd,
-			}
+			})
 		}
 	}
 }
@@ -814,19 +1073,17 @@ func (p *player) zoneCommand(cmd *command, outMsg string, selfMsg string) {
 func (p *player) serverCommand(cmd *command, outMsg string, selfMsg string) {
 	for _, other := range players {
 		if other != p {
-			if ch := other.events; ch != nil {
-				ch <- event{
-					player:  p,
-					output:  outMsg,
-					command: cmd,
-				}
-			}
+			other.send(event{
+				player:  p,
+				output:  outMsg,
+				command: cmd,
+			})
 		} else {
-			p.events <- event{
+			p.send(event{
 				player:  p,
 				output:  selfMsg,
 				command: cmd,
-			}
+			})
 		}
 	}
 }
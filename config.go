@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Server settings, read from an optional JSON file and overridden by command line flags
+type config struct {
+	Listen       string   `json:"listen"`        // Telnet listen address
+	Web          string   `json:"web"`           // Web client listen address, empty to disable
+	Database     string   `json:"database"`      // Path to the world database
+	StartRoom    int      `json:"start_room"`    // Where new characters begin
+	RecallRoom   int      `json:"recall_room"`   // Where 'recall' leads
+	MapDepth     int      `json:"map_depth"`     // Default minimap size, in rooms from the center
+	ScreenWidth  int      `json:"screen_width"`  // Width used for clients that don't report their size
+	ScreenHeight int      `json:"screen_height"` // Height used for clients that don't report their size
+	IdleTimeout  duration `json:"idle_timeout"`  // Disconnect players idle this long, 0 to never
+	LoginTimeout duration `json:"login_timeout"` // Disconnect clients that take this long to log in, 0 to never
+	TravelDelay  duration `json:"travel_delay"`  // Time between steps of the travel command
+	ServerLog    string   `json:"server_log"`    // Server log file, empty for stdout
+	EventLog     string   `json:"event_log"`     // Command log file, empty for stdout
+}
+
+var (
+	cfg = config{
+		Listen:       ":9001",
+		Web:          ":9002",
+		Database:     "world.db",
+		StartRoom:    3001,
+		RecallRoom:   3001,
+		MapDepth:     4,
+		ScreenWidth:  140,
+		ScreenHeight: 50,
+		IdleTimeout:  duration(time.Hour),
+		LoginTimeout: duration(5 * time.Minute),
+		TravelDelay:  duration(500 * time.Millisecond),
+	}
+)
+
+// A time.Duration written as "90s" or "1h30m" in config files and flags
+type duration time.Duration
+
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d *duration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations must be strings like \"30m\": %v", err)
+	}
+	return d.Set(s)
+}
+
+// Fill in cfg from the command line, reading the config file it names if any.
+// Flags take precedence over the file
+func loadConfig(args []string) error {
+	flags := flag.NewFlagSet("mud", flag.ContinueOnError)
+	configPath := flags.String("config", "", "JSON config file")
+	flags.StringVar(&cfg.Listen, "listen", cfg.Listen, "telnet listen address")
+	flags.StringVar(&cfg.Web, "web", cfg.Web, "web client listen address, empty to disable")
+	flags.StringVar(&cfg.Database, "db", cfg.Database, "path to the world database")
+	flags.IntVar(&cfg.StartRoom, "start", cfg.StartRoom, "room id new characters start in")
+	flags.IntVar(&cfg.RecallRoom, "recall", cfg.RecallRoom, "room id the recall command leads to")
+	flags.IntVar(&cfg.MapDepth, "map-depth", cfg.MapDepth, "default minimap size (1-6)")
+	flags.IntVar(&cfg.ScreenWidth, "width", cfg.ScreenWidth, "screen width for clients that don't report one")
+	flags.IntVar(&cfg.ScreenHeight, "height", cfg.ScreenHeight, "screen height for clients that don't report one")
+	flags.Var(&cfg.IdleTimeout, "idle-timeout", "disconnect idle players after this long, 0 to never")
+	flags.Var(&cfg.LoginTimeout, "login-timeout", "disconnect clients that take this long to log in, 0 to never")
+	flags.Var(&cfg.TravelDelay, "travel-delay", "time between steps of the travel command")
+	flags.StringVar(&cfg.ServerLog, "server-log", cfg.ServerLog, "server log file, empty for stdout")
+	flags.StringVar(&cfg.EventLog, "event-log", cfg.EventLog, "command log file, empty for stdout")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *configPath != "" {
+		data, err := ioutil.ReadFile(*configPath)
+		if err != nil {
+			return fmt.Errorf("reading config: %v", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return fmt.Errorf("parsing config %s: %v", *configPath, err)
+		}
+		// Parse again so flags override the file
+		flags.Parse(args)
+	}
+
+	if cfg.MapDepth < 1 || cfg.MapDepth > 6 {
+		return fmt.Errorf("map depth must be between 1 and 6")
+	}
+	if cfg.TravelDelay < 0 {
+		return fmt.Errorf("travel delay can't be negative")
+	}
+	if cfg.ScreenWidth < 1 || cfg.ScreenHeight < 1 {
+		return fmt.Errorf("screen size must be positive")
+	}
+	return nil
+}
+
+// Open a log destination from the config
+func logOutput(path string) (io.Writer, error) {
+	if path == "" {
+		return os.Stdout, nil
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+}
+
+// Check the configured rooms exist once the world is loaded
+func checkConfigRooms() error {
+	if _, exists := rooms[cfg.StartRoom]; !exists {
+		return fmt.Errorf("start room %d does not exist", cfg.StartRoom)
+	}
+	if _, exists := rooms[cfg.RecallRoom]; !exists {
+		return fmt.Errorf("recall room %d does not exist", cfg.RecallRoom)
+	}
+	return nil
+}
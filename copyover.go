@@ -0,0 +1,154 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"syscall"
+)
+
+const (
+	copyoverEnv = "MUD_COPYOVER" // Passes open connections to the next server process
+)
+
+var (
+	rebootSignals = []os.Signal{syscall.SIGUSR2} // Signals that trigger a copyover instead of a shutdown
+)
+
+// A connection handed to the next server process.
+// The handoff is JSON so nothing a client sends, like its terminal type, can change its structure
+type handoffEntry struct {
+	Name   string `json:"name"`
+	Fd     int    `json:"fd"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	TType  string `json:"ttype"`
+}
+
+func isRebootSignal(sig os.Signal) bool {
+	return sig == syscall.SIGUSR2
+}
+
+// Re-execute the server binary, keeping telnet connections open.
+// Each player is saved and their socket handed to the new process, which logs them straight back in.
+// Only returns if the new process could not be started, after closing the connections kept for it.
+// Everyone has been saved by then, and the caller should finish shutting down
+func copyover() {
+	serverLog.Println("Copyover: restarting server...")
+	exe, err := os.Executable()
+	if err != nil {
+		serverLog.Printf("Copyover: finding executable: %v", err)
+		return
+	}
+
+	var (
+		handoff []handoffEntry
+		kept    []*telnetConn
+	)
+	for _, p := range players {
+		fd, err := inheritableFd(p.conn)
+		if err != nil {
+			// WebSockets and the like can't survive the exec
+			p.send(event{
+				output: "The server is rebooting, please reconnect in a moment",
+				err:    true,
+			})
+			p.leaveWorld()
+			continue
+		}
+		width, height := p.conn.size()
+		handoff = append(handoff, handoffEntry{Name: p.name, Fd: fd, Width: width, Height: height, TType: p.conn.terminalType()})
+		kept = append(kept, p.conn)
+		p.rebooting = true
+		p.send(event{
+			output: ansiWrap("Rebooting, hold on...", colorNotice),
+		})
+		p.leaveWorld()
+	}
+	// Make sure nobody is still writing to a connection
+	writers.Wait()
+	if err := db.Close(); err != nil {
+		serverLog.Printf("closing database: %v", err)
+	}
+
+	encoded, err := json.Marshal(handoff)
+	if err == nil {
+		env := append(os.Environ(), copyoverEnv+"="+string(encoded))
+		err = syscall.Exec(exe, os.Args, env)
+	}
+	// Still here, so the kept connections have nowhere to go
+	serverLog.Printf("Copyover: exec failed: %v", err)
+	for _, conn := range kept {
+		fmt.Fprint(conn, "\r\nThe reboot failed and the server is shutting down, please reconnect later.\r\n")
+		conn.Close()
+	}
+}
+
+// Duplicate a connection's socket into a descriptor that survives exec
+func inheritableFd(conn *telnetConn) (int, error) {
+	tcp, ok := conn.Conn.(*net.TCPConn)
+	if !ok {
+		return 0, fmt.Errorf("not a TCP connection")
+	}
+	f, err := tcp.File()
+	if err != nil {
+		return 0, err
+	}
+	// The duplicate is close-on-exec by default
+	fd := int(f.Fd())
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_SETFD, 0); errno != 0 {
+		f.Close()
+		return 0, errno
+	}
+	return fd, nil
+}
+
+// Log back in any players handed over by a previous process
+func restoreCopyover(inputs chan input) {
+	handoff := os.Getenv(copyoverEnv)
+	os.Unsetenv(copyoverEnv)
+	if handoff == "" {
+		return
+	}
+	var entries []handoffEntry
+	if err := json.Unmarshal([]byte(handoff), &entries); err != nil {
+		serverLog.Printf("Copyover: bad handoff: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name
+		f := os.NewFile(uintptr(entry.Fd), name)
+		c, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			serverLog.Printf("Copyover: restoring connection for '%s': %v", name, err)
+			continue
+		}
+
+		conn := newTelnetConn(c)
+		// Keep the old size until the client renegotiates
+		conn.width, conn.height = entry.Width, entry.Height
+		conn.ttype = cleanTerminalType(entry.TType)
+
+		p := newPlayer(name, conn, log.New(conn, "CLIENT: ", log.Ldate|log.Ltime))
+		if err := p.loadState(); err != nil {
+			serverLog.Printf("Copyover: loading player '%s': %v", name, err)
+			fmt.Fprintln(conn, "Unable to load your character after the reboot, please log in again")
+			conn.Close()
+			continue
+		}
+		if err := p.enterWorld(); err != nil {
+			serverLog.Printf("Copyover: player '%s': %v", name, err)
+			conn.Close()
+			continue
+		}
+		go p.readInputs(bufio.NewScanner(conn), inputs)
+	}
+	broadcast("Reboot complete!")
+}
@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+	"os"
+)
+
+var (
+	rebootSignals []os.Signal // Copyover is not supported on this platform
+)
+
+func isRebootSignal(sig os.Signal) bool {
+	return false
+}
+
+// Copyover needs to pass sockets through exec, so just shut down
+func copyover() {
+	serverLog.Println("Copyover is not supported on this platform")
+}
+
+func restoreCopyover(inputs chan input) {}
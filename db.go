@@ -3,18 +3,21 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
-	db    *sql.DB
-	zones map[int]*zone
-	rooms map[int]*room
+	db      *sql.DB
+	zones   map[int]*zone
+	rooms   map[int]*room
+	objects map[int]*object
+	mobiles map[int]*mobile
+	mobs    []*mob // Every mobile instance in the world
 )
 
 const (
-	path    = "world.db" // the path to the database--this could be an absolute path
 	options = "?" + "_busy_timeout=10000" +
 		"&" + "_foreign_keys=ON" +
 		"&" + "_journal_mode=WAL" +
@@ -22,15 +25,194 @@ const (
 		"&" + "_synchronous=NORMAL"
 )
 
-// Load all rooms, zones, exits and link them appropriately
+// Schema changes made on top of the original world tables, applied in order.
+// The database's user_version records how many have already been applied
+var migrations = []string{
+	// 1: Player accounts
+	`CREATE TABLE accounts (
+		name            TEXT PRIMARY KEY COLLATE NOCASE,
+		password        BLOB NOT NULL,
+		created         INTEGER NOT NULL
+	)`,
+	// 2: Saved player state
+	`CREATE TABLE players (
+		name            TEXT PRIMARY KEY COLLATE NOCASE,
+		room_id         INTEGER NOT NULL,
+		play_time       INTEGER NOT NULL,
+		last_seen       INTEGER NOT NULL,
+
+		FOREIGN KEY(name) REFERENCES accounts(name)
+	);
+	CREATE TABLE visited (
+		player          TEXT NOT NULL COLLATE NOCASE,
+		room_id         INTEGER NOT NULL,
+
+		PRIMARY KEY(player, room_id),
+		FOREIGN KEY(player) REFERENCES accounts(name)
+	);
+	CREATE TABLE preferences (
+		player          TEXT NOT NULL COLLATE NOCASE,
+		key             TEXT NOT NULL,
+		value           TEXT NOT NULL,
+
+		PRIMARY KEY(player, key),
+		FOREIGN KEY(player) REFERENCES accounts(name)
+	)`,
+	// 3: Objects and the items made from them
+	`CREATE TABLE objects (
+		id              INTEGER PRIMARY KEY,
+		keywords        TEXT NOT NULL,
+		name            TEXT NOT NULL,
+		ground          TEXT NOT NULL,
+		description     TEXT NOT NULL
+	);
+	CREATE TABLE items (
+		id              INTEGER PRIMARY KEY,
+		object_id       INTEGER NOT NULL,
+		room_id         INTEGER,
+		owner           TEXT COLLATE NOCASE,
+
+		CHECK((room_id IS NULL) != (owner IS NULL)),
+		FOREIGN KEY(object_id) REFERENCES objects(id),
+		FOREIGN KEY(room_id) REFERENCES rooms(id),
+		FOREIGN KEY(owner) REFERENCES accounts(name)
+	);
+	INSERT INTO objects (id, keywords, name, ground, description) VALUES
+		(3000, 'bread loaf', 'a loaf of bread', 'A fresh loaf of bread has been left here.', 'The crust is golden brown and it still smells of the oven.'),
+		(3001, 'torch', 'a torch', 'A wooden torch lies on the ground.', 'A stick of wood wrapped in oily rags at one end.'),
+		(3002, 'dagger', 'a small dagger', 'A small dagger is lying here.', 'A short, plain blade. It looks sharp enough to be useful.'),
+		(3003, 'candle', 'a white candle', 'A white candle stands here, unlit.', 'A thick candle of white wax, the kind burned at the altar.'),
+		(3004, 'map parchment', 'a map of Midgaard', 'A rolled up parchment has been dropped here.', 'A rough sketch of the streets of Midgaard. The temple is marked at the center.'),
+		(3005, 'mug', 'a pewter mug', 'A dented pewter mug sits here.', 'It smells faintly of ale.');
+	INSERT INTO items (object_id, room_id) VALUES
+		(3003, 3054),
+		(3004, 3001),
+		(3000, 3009),
+		(3000, 3009),
+		(3001, 3010),
+		(3002, 3011),
+		(3005, 3007),
+		(3005, 3007)`,
+	// 4: Mobiles, what they say and where they appear
+	`CREATE TABLE mobiles (
+		id              INTEGER PRIMARY KEY,
+		keywords        TEXT NOT NULL,
+		name            TEXT NOT NULL,
+		description     TEXT NOT NULL,
+		wander          INTEGER NOT NULL DEFAULT 0,
+		stay_zone       INTEGER NOT NULL DEFAULT 1
+	);
+	CREATE TABLE mobile_responses (
+		mobile_id       INTEGER NOT NULL,
+		kind            TEXT NOT NULL CHECK(kind IN ('say', 'emote')),
+		trigger         TEXT NOT NULL COLLATE NOCASE,
+		response        TEXT NOT NULL,
+
+		PRIMARY KEY(mobile_id, kind, trigger),
+		FOREIGN KEY(mobile_id) REFERENCES mobiles(id)
+	);
+	CREATE TABLE mobile_instances (
+		id              INTEGER PRIMARY KEY,
+		mobile_id       INTEGER NOT NULL,
+		room_id         INTEGER NOT NULL,
+
+		FOREIGN KEY(mobile_id) REFERENCES mobiles(id),
+		FOREIGN KEY(room_id) REFERENCES rooms(id)
+	);
+	INSERT INTO mobiles (id, keywords, name, description, wander, stay_zone) VALUES
+		(3060, 'cityguard guard', 'the cityguard', 'A big, strong, helpful and trustworthy guard in the service of the city.', 25, 1),
+		(3061, 'baker', 'the baker', 'Flour dusts his apron and his arms. He looks proud of his bread.', 0, 1),
+		(3062, 'priest cleric', 'the high priest', 'An old man in white robes who tends to the temple and the lost souls who find it.', 0, 1),
+		(3063, 'fido dog', 'Fido', 'A scruffy mongrel with a keen nose for the dump.', 40, 1),
+		(3064, 'beggar', 'the beggar', 'A thin man in rags, hoping for a kind word or a coin.', 15, 1);
+	INSERT INTO mobile_responses (mobile_id, kind, trigger, response) VALUES
+		(3060, 'say', 'help', 'Keep to the streets and you will come to no harm, citizen.'),
+		(3060, 'say', 'hello', 'Move along, $n.'),
+		(3060, 'emote', 'poke', 'The cityguard glares at $n and rests a hand on his sword.'),
+		(3060, 'emote', 'smile', 'The cityguard nods curtly at $n.'),
+		(3061, 'say', 'bread', 'Fresh bread, still warm from the oven!'),
+		(3061, 'say', 'hello', 'Welcome to my bakery, $n.'),
+		(3061, 'emote', 'smile', 'The baker smiles back at $n.'),
+		(3062, 'say', 'hello', 'Peace be with you, $n.'),
+		(3062, 'say', 'help', 'Type recall wherever you are and you will find your way back here.'),
+		(3062, 'emote', 'laugh', 'The high priest chuckles softly.'),
+		(3063, 'emote', 'poke', 'Fido growls at $n.'),
+		(3063, 'emote', 'smile', 'Fido wags his tail at $n.'),
+		(3064, 'say', 'coin', 'Bless you, bless you!'),
+		(3064, 'emote', 'sigh', 'The beggar sighs along with $n. Times are hard.');
+	INSERT INTO mobile_instances (mobile_id, room_id) VALUES
+		(3060, 3014),
+		(3060, 3040),
+		(3061, 3009),
+		(3062, 3001),
+		(3063, 3030),
+		(3064, 3044)`,
+	// 5: Doors on exits. Both sides of a door are stored and share their state once loaded
+	`ALTER TABLE exits ADD COLUMN door TEXT NOT NULL DEFAULT 'none' CHECK(door IN ('none', 'open', 'closed', 'locked'));
+	ALTER TABLE exits ADD COLUMN door_name TEXT NOT NULL DEFAULT 'door';
+	ALTER TABLE exits ADD COLUMN hidden INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE exits ADD COLUMN key_id INTEGER REFERENCES objects(id);
+	ALTER TABLE exits ADD COLUMN pickproof INTEGER NOT NULL DEFAULT 0;
+	INSERT INTO objects (id, keywords, name, ground, description) VALUES
+		(3006, 'key iron', 'an iron key', 'A small iron key lies forgotten in the dust.', 'A plain iron key, its teeth worn smooth. A tiny dagger is scratched into the bow.');
+	INSERT INTO items (object_id, room_id) VALUES (3006, 3050);
+	UPDATE exits SET door = 'closed', door_name = 'gate' WHERE (from_room_id, direction) IN (VALUES (3040, 'w'), (3052, 'e'), (3041, 'e'), (3053, 'w'));
+	UPDATE exits SET door = 'closed' WHERE (from_room_id, direction) IN (VALUES (3017, 's'), (3018, 'n'));
+	UPDATE exits SET door = 'locked', key_id = 3006 WHERE (from_room_id, direction) IN (VALUES (3028, 's'), (3029, 'n'));
+	UPDATE exits SET hidden = 1 WHERE from_room_id = 3028 AND direction = 's'`,
+	// 6: Room flags and fighting stats for players and mobiles
+	`ALTER TABLE rooms ADD COLUMN flags TEXT NOT NULL DEFAULT '';
+	ALTER TABLE players ADD COLUMN hit_points INTEGER NOT NULL DEFAULT 20;
+	ALTER TABLE players ADD COLUMN max_hit_points INTEGER NOT NULL DEFAULT 20;
+	ALTER TABLE players ADD COLUMN strength INTEGER NOT NULL DEFAULT 10;
+	ALTER TABLE players ADD COLUMN dexterity INTEGER NOT NULL DEFAULT 10;
+	ALTER TABLE mobiles ADD COLUMN max_hit_points INTEGER NOT NULL DEFAULT 10;
+	ALTER TABLE mobiles ADD COLUMN strength INTEGER NOT NULL DEFAULT 8;
+	ALTER TABLE mobiles ADD COLUMN dexterity INTEGER NOT NULL DEFAULT 8;
+	ALTER TABLE mobiles ADD COLUMN attack TEXT NOT NULL DEFAULT 'hit';
+	UPDATE rooms SET flags = 'peaceful' WHERE id IN (3001, 3054);
+	UPDATE mobiles SET max_hit_points = 40, strength = 14, dexterity = 12 WHERE id = 3060;
+	UPDATE mobiles SET max_hit_points = 25, strength = 12, dexterity = 10 WHERE id = 3062;
+	UPDATE mobiles SET max_hit_points = 12, strength = 8, dexterity = 14, attack = 'bite' WHERE id = 3063;
+	UPDATE mobiles SET max_hit_points = 8, strength = 6, dexterity = 6 WHERE id = 3064`,
+	// 7: Ranks for builders and admins
+	`ALTER TABLE accounts ADD COLUMN rank TEXT NOT NULL DEFAULT 'player' CHECK(rank IN ('player', 'builder', 'admin'))`,
+	// 8: Named rooms players can travel back to
+	`CREATE TABLE bookmarks (
+		player          TEXT NOT NULL COLLATE NOCASE,
+		name            TEXT NOT NULL COLLATE NOCASE,
+		room_id         INTEGER NOT NULL,
+
+		PRIMARY KEY(player, name),
+		FOREIGN KEY(player) REFERENCES accounts(name)
+	)`,
+	// 9: Colors players chose over their theme's
+	`CREATE TABLE colors (
+		player          TEXT NOT NULL COLLATE NOCASE,
+		kind            TEXT NOT NULL,
+		color           TEXT NOT NULL,
+
+		PRIMARY KEY(player, kind),
+		FOREIGN KEY(player) REFERENCES accounts(name)
+	)`,
+}
+
+// Load all rooms, zones, exits and link them appropriately.
+// The database stays open for player data
 func loadWorld() error {
 	var err error
-	db, err = sql.Open("sqlite3", path+options)
+	db, err = sql.Open("sqlite3", cfg.Database+options)
 	if err != nil {
 		return fmt.Errorf("opening database: %v", err)
 	}
-	defer db.Close()
 
+	if err := migrate(); err != nil {
+		return fmt.Errorf("updating schema: %v", err)
+	}
+	// Report layout problems, the same checks as 'mud lint'
+	if err := readTransaction(logLint); err != nil {
+		return fmt.Errorf("checking world: %v", err)
+	}
 	// Read zones
 	if err := readTransaction(readZones); err != nil {
 		return fmt.Errorf("reading zones: %v", err)
@@ -43,6 +225,65 @@ func loadWorld() error {
 	if err := readTransaction(readExits); err != nil {
 		return fmt.Errorf("reading exits: %v", err)
 	}
+	// Read objects
+	if err := readTransaction(readObjects); err != nil {
+		return fmt.Errorf("reading objects: %v", err)
+	}
+	// Read items lying in rooms
+	if err := readTransaction(readRoomItems); err != nil {
+		return fmt.Errorf("reading items: %v", err)
+	}
+	// Read mobiles and place them
+	if err := readTransaction(readMobiles); err != nil {
+		return fmt.Errorf("reading mobiles: %v", err)
+	}
+	if err := readTransaction(readMobileInstances); err != nil {
+		return fmt.Errorf("reading mobile instances: %v", err)
+	}
+
+	return nil
+}
+
+// Apply any migrations the database hasn't seen yet
+func migrate() error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %v", err)
+	}
+	for ; version < len(migrations); version++ {
+		err := writeTransaction(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(migrations[version]); err != nil {
+				return err
+			}
+			// PRAGMA does not accept parameters
+			_, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %v", version+1, err)
+		}
+		serverLog.Printf("Applied database migration %d\n", version+1)
+	}
+	return nil
+}
+
+// A wrapper function for a write transaction.
+// Rolls back if f returns an error
+func writeTransaction(f func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("starting transaction: %v", err)
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("committing transaction: %v", err)
+	}
 
 	return nil
 }
@@ -55,6 +296,7 @@ func readTransaction(f func(tx *sql.Tx) error) error {
 	}
 
 	if err := f(tx); err != nil {
+		tx.Rollback()
 		return err
 	}
 
@@ -101,7 +343,7 @@ func readZones(tx *sql.Tx) error {
 
 // Reads rooms and links them to zones. Rooms are stored in the 'rooms' map
 func readRooms(tx *sql.Tx) error {
-	rows, err := tx.Query("SELECT * FROM rooms")
+	rows, err := tx.Query("SELECT id, zone_id, name, description, flags FROM rooms")
 	if err != nil {
 		return fmt.Errorf("querying rooms: %v", err)
 	}
@@ -114,10 +356,15 @@ func readRooms(tx *sql.Tx) error {
 			zoneID int
 			name   string
 			desc   string
+			flags  string
 		)
-		if err = rows.Scan(&id, &zoneID, &name, &desc); err != nil {
+		if err = rows.Scan(&id, &zoneID, &name, &desc, &flags); err != nil {
 			return fmt.Errorf("reading a room: %v", err)
 		}
+		// Rooms in missing zones are reported by the world check and left out
+		if zones[zoneID] == nil {
+			continue
+		}
 
 		// Store room
 		rooms[id] = &room{
@@ -125,6 +372,7 @@ func readRooms(tx *sql.Tx) error {
 			zone:        zones[zoneID],
 			name:        name,
 			description: desc,
+			flags:       parseRoomFlags(flags),
 			players:     []*player{},
 		}
 		// Link to zone
@@ -138,9 +386,10 @@ func readRooms(tx *sql.Tx) error {
 	return nil
 }
 
-// Reads exits and links them to rooms
+// Reads exits and links them to rooms.
+// The two sides of a door are joined so opening one opens the other
 func readExits(tx *sql.Tx) error {
-	rows, err := tx.Query("SELECT * FROM exits")
+	rows, err := tx.Query("SELECT from_room_id, to_room_id, direction, description, door, door_name, hidden, key_id, pickproof FROM exits")
 	if err != nil {
 		return fmt.Errorf("querying exits: %v", err)
 	}
@@ -148,24 +397,260 @@ func readExits(tx *sql.Tx) error {
 
 	for rows.Next() {
 		var (
-			fromID int
-			toID   int
-			dir    string
-			desc   string
+			fromID    int
+			toID      int
+			dir       string
+			desc      string
+			state     string
+			doorName  string
+			hidden    bool
+			keyID     sql.NullInt64
+			pickproof bool
 		)
-		if err := rows.Scan(&fromID, &toID, &dir, &desc); err != nil {
+		if err := rows.Scan(&fromID, &toID, &dir, &desc, &state, &doorName, &hidden, &keyID, &pickproof); err != nil {
 			return fmt.Errorf("reading an exit: %v", err)
 		}
-		// Link exit to room
-		rooms[fromID].exits[dirRuneToInt[rune(dir[0])]] = exit{
+		// Broken exits are reported by the world check and left out
+		if rooms[fromID] == nil || rooms[toID] == nil || !validDirection(dir) {
+			continue
+		}
+		e := exit{
 			to:          rooms[toID],
 			description: desc,
+			hidden:      hidden,
+		}
+		if state != "none" {
+			e.door = &door{
+				name:      doorName,
+				state:     doorStates[state],
+				key:       int(keyID.Int64),
+				pickproof: pickproof,
+			}
 		}
+		// Link exit to room
+		rooms[fromID].exits[dirRuneToInt[rune(dir[0])]] = e
 	}
 	// Check for errors from iterating over rows.
 	if err := rows.Err(); err != nil {
 		return fmt.Errorf("iterating over exits: %v", err)
 	}
 
+	// Both sides of a door share it. Hidden stays per exit, so a door can be secret from one side only
+	for _, r := range rooms {
+		for dir, e := range r.exits {
+			if e.door == nil || e.to == nil {
+				continue
+			}
+			if back := &e.to.exits[oppositeDirction[dir]]; back.to == r && back.door != nil {
+				back.door = e.door
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reads all objects into the 'objects' map
+func readObjects(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, keywords, name, ground, description FROM objects")
+	if err != nil {
+		return fmt.Errorf("querying objects: %v", err)
+	}
+	defer rows.Close()
+
+	objects = make(map[int]*object)
+	for rows.Next() {
+		var (
+			id                             int
+			keywords, name, ground, detail string
+		)
+		if err := rows.Scan(&id, &keywords, &name, &ground, &detail); err != nil {
+			return fmt.Errorf("reading an object: %v", err)
+		}
+		objects[id] = &object{
+			id:          id,
+			keywords:    strings.Fields(strings.ToLower(keywords)),
+			name:        name,
+			ground:      ground,
+			description: detail,
+		}
+	}
+	// Check for errors from iterating over rows.
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating over objects: %v", err)
+	}
+
+	return nil
+}
+
+// Reads items lying in rooms and places them
+func readRoomItems(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, object_id, room_id FROM items WHERE room_id IS NOT NULL ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("querying items: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, objectID, roomID int
+		if err := rows.Scan(&id, &objectID, &roomID); err != nil {
+			return fmt.Errorf("reading an item: %v", err)
+		}
+		r, o := rooms[roomID], objects[objectID]
+		if r == nil || o == nil {
+			serverLog.Printf("item %d refers to a missing room or object", id)
+			continue
+		}
+		r.items = append(r.items, &item{id: id, object: o})
+	}
+	// Check for errors from iterating over rows.
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating over items: %v", err)
+	}
+
+	return nil
+}
+
+// Reads mobile prototypes and their responses into the 'mobiles' map
+func readMobiles(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, keywords, name, description, wander, stay_zone, max_hit_points, strength, dexterity, attack FROM mobiles")
+	if err != nil {
+		return fmt.Errorf("querying mobiles: %v", err)
+	}
+	defer rows.Close()
+
+	mobiles = make(map[int]*mobile)
+	for rows.Next() {
+		var (
+			id, wander                   int
+			stayZone                     bool
+			keywords, name, desc, attack string
+			s                            stats
+		)
+		if err := rows.Scan(&id, &keywords, &name, &desc, &wander, &stayZone, &s.maxHP, &s.strength, &s.dexterity, &attack); err != nil {
+			return fmt.Errorf("reading a mobile: %v", err)
+		}
+		mobiles[id] = &mobile{
+			id:          id,
+			keywords:    strings.Fields(strings.ToLower(keywords)),
+			name:        name,
+			description: desc,
+			wander:      wander,
+			stayZone:    stayZone,
+			stats:       s,
+			attack:      attack,
+			sayings:     make(map[string]string),
+			reactions:   make(map[string]string),
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating over mobiles: %v", err)
+	}
+
+	responses, err := tx.Query("SELECT mobile_id, kind, trigger, response FROM mobile_responses")
+	if err != nil {
+		return fmt.Errorf("querying mobile responses: %v", err)
+	}
+	defer responses.Close()
+
+	for responses.Next() {
+		var (
+			id                      int
+			kind, trigger, response string
+		)
+		if err := responses.Scan(&id, &kind, &trigger, &response); err != nil {
+			return fmt.Errorf("reading a mobile response: %v", err)
+		}
+		m, exists := mobiles[id]
+		if !exists {
+			continue
+		}
+		if kind == "say" {
+			m.sayings[strings.ToLower(trigger)] = response
+		} else {
+			m.reactions[strings.ToLower(trigger)] = response
+		}
+	}
+	if err := responses.Err(); err != nil {
+		return fmt.Errorf("iterating over mobile responses: %v", err)
+	}
+
+	return nil
+}
+
+// Reads mobile instances and places them in their home rooms
+func readMobileInstances(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, mobile_id, room_id FROM mobile_instances ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("querying mobile instances: %v", err)
+	}
+	defer rows.Close()
+
+	mobs = nil
+	for rows.Next() {
+		var id, mobileID, roomID int
+		if err := rows.Scan(&id, &mobileID, &roomID); err != nil {
+			return fmt.Errorf("reading a mobile instance: %v", err)
+		}
+		r, m := rooms[roomID], mobiles[mobileID]
+		if r == nil || m == nil {
+			serverLog.Printf("mobile instance %d refers to a missing room or mobile", id)
+			continue
+		}
+		mb := &mob{id: id, mobile: m, room: r, home: r, stats: m.stats}
+		mb.stats.hp = mb.stats.maxHP
+		r.mobs = append(r.mobs, mb)
+		mobs = append(mobs, mb)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating over mobile instances: %v", err)
+	}
+
+	return nil
+}
+
+// Store a new zone, returning its id
+func insertZone(tx *sql.Tx, name string) (int, error) {
+	res, err := tx.Exec("INSERT INTO zones (name) VALUES (?)", name)
+	if err != nil {
+		return 0, fmt.Errorf("inserting zone: %v", err)
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// Store a new room, returning its id
+func insertRoom(tx *sql.Tx, zoneID int, name string, desc string) (int, error) {
+	res, err := tx.Exec("INSERT INTO rooms (zone_id, name, description) VALUES (?, ?, ?)", zoneID, name, desc)
+	if err != nil {
+		return 0, fmt.Errorf("inserting room: %v", err)
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// Write a room's name and description
+func updateRoom(tx *sql.Tx, id int, name string, desc string) error {
+	if _, err := tx.Exec("UPDATE rooms SET name = ?, description = ? WHERE id = ?", name, desc, id); err != nil {
+		return fmt.Errorf("updating room %d: %v", id, err)
+	}
+	return nil
+}
+
+// Store a new exit without a door
+func insertExit(tx *sql.Tx, fromID int, dir int, toID int, desc string) error {
+	_, err := tx.Exec("INSERT INTO exits (from_room_id, to_room_id, direction, description) VALUES (?, ?, ?, ?)",
+		fromID, toID, string(dirIntToRune[dir]), desc)
+	if err != nil {
+		return fmt.Errorf("inserting exit: %v", err)
+	}
+	return nil
+}
+
+// Remove an exit
+func deleteExit(tx *sql.Tx, fromID int, dir int) error {
+	if _, err := tx.Exec("DELETE FROM exits WHERE from_room_id = ? AND direction = ?", fromID, string(dirIntToRune[dir])); err != nil {
+		return fmt.Errorf("deleting exit: %v", err)
+	}
 	return nil
 }
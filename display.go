@@ -3,55 +3,63 @@ package main
 import (
 	"fmt"
 	"strings"
+	"unicode/utf8"
 )
 
 const (
-	fullWidth = 140
+	minTextWidth = 20 // The narrowest the event pane will wrap to
 )
 
 var (
-	ansiColors map[string]string
+	// Clients that lay out the screen themselves, by the start of the terminal type they report
+	plainTerminals = []string{"dumb", "mudlet", "mushclient", "tintin", "zmud", "cmud", "blowtorch", "mudrammer", "potato", "atlantis"}
 )
 
 func (p *player) eventPrint(ev event) {
-	width := fullWidth - p.minimap.width
+	width := p.textWidth()
 	text := ev.output
 
 	// Erase old prompt
 	p.erasePrompt(ev)
 
-	col := 0
+	// col is the byte offset, visible the number of columns it takes on screen
+	col, visible := 0, 0
 	for len(text) > col {
 		if text[col] == '\n' {
 			line := text[:col]
 			text = text[col+1:]
 			zeroCol(p)
-			fmt.Fprintf(p.conn, "%s\n", line)
+			fmt.Fprintf(p.out, "%s\n", line)
 			zeroCol(p)
-			fmt.Fprintf(p.conn, "\x1b[1A\x1b[2D%c\x1b[1B", '║')
-			col = 0
+			fmt.Fprintf(p.out, "\x1b[1A\x1b[2D%c\x1b[1B", '║')
+			col, visible = 0, 0
 			continue
 		}
-		if col > width {
+		if visible > width {
 			rawLine := text[:col]
 			truncateIdx := strings.LastIndex(rawLine, " ")
+			if truncateIdx <= 0 {
+				// No space to break on
+				truncateIdx = col
+			}
 			line := text[:truncateIdx]
 			text = text[truncateIdx:]
 			zeroCol(p)
-			fmt.Fprintf(p.conn, "%s\n", line)
+			fmt.Fprintf(p.out, "%s\n", line)
 			zeroCol(p)
-			fmt.Fprintf(p.conn, "\x1b[1A\x1b[2D%c\x1b[1B", '║')
-			col = 0
+			fmt.Fprintf(p.out, "\x1b[1A\x1b[2D%c\x1b[1B", '║')
+			col, visible = 0, 0
 			continue
 		}
-		col++
+		next, w := advance(text, col)
+		col, visible = next, visible+w
 	}
 	// Print remaining text
 	zeroCol(p)
-	fmt.Fprintf(p.conn, "%s\n\n", text)
+	fmt.Fprintf(p.out, "%s\n\n", text)
 
 	// Make space for prompt (so map fits snugly)
-	fmt.Fprintf(p.conn, "\n")
+	fmt.Fprintf(p.out, "\n")
 
 	p.drawMap()
 
@@ -61,19 +69,68 @@ func (p *player) eventPrint(ev event) {
 	p.drawDivider()
 
 	// Move cursor to correct position
-	fmt.Fprintf(p.conn, "\x1b[1000B")
+	fmt.Fprintf(p.out, "\x1b[1000B")
 	zeroCol(p)
-	fmt.Fprintf(p.conn, "\x1b[4C")
+	fmt.Fprintf(p.out, "\x1b[4C")
+}
+
+// Print an event as lines of text, for MUD clients, logs and screen readers
+func (p *player) plainPrint(ev event) {
+	// Minimap and display updates have nothing to show here
+	if ev.output == "" {
+		return
+	}
+	if ev.unsolicited {
+		// Move off the prompt the player hasn't answered
+		fmt.Fprint(p.out, "\r\n")
+	}
+	fmt.Fprintf(p.out, "%s\r\n> ", strings.ReplaceAll(ev.output, "\n", "\r\n"))
+}
+
+// Remove colors and other escape codes from text
+func stripANSI(text string) string {
+	var w strings.Builder
+	for col := 0; col < len(text); {
+		next, width := advance(text, col)
+		if width > 0 {
+			w.WriteString(text[col:next])
+		}
+		col = next
+	}
+	return w.String()
+}
+
+// Step over one character of text, returning where the next one starts and how many columns it takes.
+// Colors and other escape codes take none, and multi-byte characters take one
+func advance(text string, col int) (int, int) {
+	if text[col] == '\x1b' && col+1 < len(text) && text[col+1] == '[' {
+		end := col + 2
+		for end < len(text) && (text[end] < 0x40 || text[end] > 0x7e) {
+			end++
+		}
+		return end + 1, 0
+	}
+	_, size := utf8.DecodeRuneInString(text[col:])
+	return col + size, 1
+}
+
+// The number of columns available to the event pane
+func (p *player) textWidth() int {
+	width, _ := p.conn.size()
+	if width -= p.view.width + 3; width < minTextWidth {
+		return minTextWidth
+	}
+	return width
 }
 
 // Go to the 0 column for the event display
 func zeroCol(p *player) {
-	fmt.Fprintf(p.conn, "\x1b[%dG", p.minimap.width+3)
+	fmt.Fprintf(p.out, "\x1b[%dG", p.view.width+3)
 }
 
 // Go to the 0 column for the event display
 func dividerCol(p *player) {
-	fmt.Fprintf(p.conn, "\x1b[%dG", p.minimap.width+1)
+	fmt.Fprintf(p.out, "\x1b[%dG", p.view.width+1)
 }
 
 // Erase player's old prompt
@@ -81,48 +138,69 @@ func (p *player) erasePrompt(ev event) {
 	// Clear last 2 lines
 	if !ev.unsolicited {
 		// Account for newline from user pressing enter
-		fmt.Fprintf(p.conn, "\x1b[1A")
+		fmt.Fprintf(p.out, "\x1b[1A")
 	}
 	for i := 0; i < 2; i++ {
-		fmt.Fprintf(p.conn, "\x1b[%dG\x1b[0K\x1b[1A", p.minimap.width)
+		fmt.Fprintf(p.out, "\x1b[%dG\x1b[0K\x1b[1A", p.view.width)
 	}
 	// Back to print location
-	fmt.Fprint(p.conn, "\x1b[1B")
+	fmt.Fprint(p.out, "\x1b[1B")
 	zeroCol(p)
 }
 
 // Display player command prompt
 func (p *player) prompt() {
 	// Go to bottom fo screen in events channel
-	fmt.Fprintf(p.conn, "\x1b[10000B")
+	fmt.Fprintf(p.out, "\x1b[10000B")
 	zeroCol(p)
-	fmt.Fprintf(p.conn, "\x1b[1A")
+	fmt.Fprintf(p.out, "\x1b[1A")
 	zeroCol(p)
-	fmt.Fprintf(p.conn, "%s\x1b[1B", strings.Repeat("_", fullWidth-p.minimap.width)) // Separator
+	fmt.Fprintf(p.out, "%s\x1b[1B", strings.Repeat("_", p.textWidth())) // Separator
 	zeroCol(p)
-	fmt.Fprintf(p.conn, ">>> ")
+	fmt.Fprintf(p.out, ">>> ")
 }
 
 // Draws the vertical divider for the visible screen
 func (p *player) drawDivider() {
+	_, height := p.conn.size()
 	// Cursor top left
-	fmt.Fprintf(p.conn, "\x1b[1000A")
+	fmt.Fprintf(p.out, "\x1b[1000A")
 	dividerCol(p)
-	for i := 0; i <= 100; i++ {
-		fmt.Fprintf(p.conn, "%c\x1b[1B\x1b[1D", '║')
+	for i := 0; i < height; i++ {
+		fmt.Fprintf(p.out, "%c\x1b[1B\x1b[1D", '║')
 	}
 }
 
 func (p *player) drawMap() {
-	lines := p.minimap.render()
 	// Cursor top left of screen
-	fmt.Fprint(p.conn, "\x1b[H")
-	for _, line := range lines {
-		fmt.Fprintf(p.conn, "%s\x1b[1E", line)
+	fmt.Fprint(p.out, "\x1b[H")
+	for _, line := range p.view.lines {
+		fmt.Fprintf(p.out, "%s\x1b[1E", p.screen.paint(line))
+	}
+}
+
+// Mark some text as a kind of output, to be colored by the theme of whoever it is printed for
+func ansiWrap(text string, kind colorKind) string {
+	return fmt.Sprintf("\x1b[=%dm%s\x1b[0m", kind, text)
+}
+
+func (p *player) applyDisplay(value string) error {
+	switch value {
+	case "auto":
+		ttype := strings.ToLower(p.conn.terminalType())
+		p.display.plain = contain(len(plainTerminals), func(idx int) bool { return strings.HasPrefix(ttype, plainTerminals[idx]) })
+	case "full", "plain":
+		p.display.plain = value == "plain"
+	default:
+		return fmt.Errorf("The display must be auto, full or plain")
 	}
+	return nil
 }
 
-// Wrap some text in an ansi code
-func ansiWrap(text string, code string) string {
-	return fmt.Sprintf("%s%s\x1b[0m", code, text)
+func (p *player) applyColor(value string) error {
+	if value != "on" && value != "off" {
+		return fmt.Errorf("Color must be on or off")
+	}
+	p.display.color = value == "on"
+	return nil
 }
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Door states
+const (
+	doorOpen doorState = iota
+	doorClosed
+	doorLocked
+)
+
+const (
+	pickChance = 40 // Percent chance to pick a lock
+)
+
+var (
+	doorStates = map[string]doorState{
+		"open":   doorOpen,
+		"closed": doorClosed,
+		"locked": doorLocked,
+	}
+)
+
+// Whether a closed door is in the way
+func (e exit) blocked() bool {
+	return e.door != nil && e.door.state != doorOpen
+}
+
+// Whether players can tell the exit is there
+func (e exit) visible() bool {
+	return e.to != nil && !(e.hidden && e.blocked())
+}
+
+// Find the direction of the door a player means, by direction or by the door's name.
+// Hidden doors can only be found by someone who knows which way to look.
+// Returns -1 if there is no such door
+func (p *player) findDoor(word string) int {
+	if dir := parseDirection(word); dir != -1 {
+		if p.room.exits[dir].door == nil {
+			return -1
+		}
+		return dir
+	}
+	word = strings.ToLower(word)
+	return index(len(p.room.exits), func(dir int) bool {
+		e := p.room.exits[dir]
+		return e.door != nil && e.visible() && strings.HasPrefix(e.door.name, word)
+	})
+}
+
+// Whether the player carries the key to a door
+func (p *player) hasKey(d *door) bool {
+	return d.key != 0 && contain(len(p.inventory), func(idx int) bool { return p.inventory[idx].object.id == d.key })
+}
+
+// Look up the door for a door command, telling the player if there isn't one
+func (p *player) doorCommand(cmd string, usage string) (int, *door) {
+	words := strings.Fields(cmd)
+	if len(words) != 1 {
+		p.send(event{
+			player: p,
+			output: usage,
+			err:    true,
+		})
+		return -1, nil
+	}
+	dir := p.findDoor(words[0])
+	if dir == -1 {
+		p.send(event{
+			player: p,
+			output: "There's no door there...",
+			err:    true,
+		})
+		return -1, nil
+	}
+	return dir, p.room.exits[dir].door
+}
+
+// Change the state of a door and let both sides see it happen
+func (p *player) setDoor(dir int, state doorState, cmd *command, verb string) {
+	d := p.room.exits[dir].door
+	d.state = state
+	p.roomCommand(
+		cmd,
+		fmt.Sprintf("%s %ss the %s.", p.name, verb, d.name),
+		fmt.Sprintf("You %s the %s.", verb, d.name),
+	)
+	other := p.room.exits[dir].to
+	if back := other.exits[oppositeDirction[dir]]; back.to == p.room && back.door == d && back.visible() {
+		for _, o := range other.players {
+			o.send(event{
+				output:  fmt.Sprintf("The %s is %sed from the other side.", d.name, strings.TrimSuffix(verb, "e")),
+				command: cmd,
+			})
+		}
+	}
+	// Doors change what the minimaps show on both sides
+	for _, r := range []*room{p.room, other} {
+		for _, o := range r.players {
+			o.send(event{
+				minimap: o.minimap.snapshot(o.room, o.visited),
+			})
+		}
+	}
+}
+
+// Doors
+
+func (p *player) doOpen(cmd string) {
+	dir, d := p.doorCommand(cmd, "Usage: open <direction|door>")
+	switch {
+	case d == nil:
+	case d.state == doorOpen:
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("The %s is already open.", d.name),
+		})
+	case d.state == doorLocked:
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("The %s is locked.", d.name),
+		})
+	default:
+		p.setDoor(dir, doorOpen, commands["open"], "open")
+	}
+}
+
+func (p *player) doClose(cmd string) {
+	dir, d := p.doorCommand(cmd, "Usage: close <direction|door>")
+	switch {
+	case d == nil:
+	case d.state != doorOpen:
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("The %s is already closed.", d.name),
+		})
+	default:
+		p.setDoor(dir, doorClosed, commands["close"], "close")
+	}
+}
+
+func (p *player) doLock(cmd string) {
+	dir, d := p.doorCommand(cmd, "Usage: lock <direction|door>")
+	switch {
+	case d == nil:
+	case d.state == doorOpen:
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("You have to close the %s first.", d.name),
+		})
+	case d.state == doorLocked:
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("The %s is already locked.", d.name),
+		})
+	case d.key == 0:
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("The %s has no lock.", d.name),
+		})
+	case !p.hasKey(d):
+		p.send(event{
+			player: p,
+			output: "You don't have the key.",
+		})
+	default:
+		p.setDoor(dir, doorLocked, commands["lock"], "lock")
+	}
+}
+
+func (p *player) doUnlock(cmd string) {
+	dir, d := p.doorCommand(cmd, "Usage: unlock <direction|door>")
+	switch {
+	case d == nil:
+	case d.state != doorLocked:
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("The %s isn't locked.", d.name),
+		})
+	case !p.hasKey(d):
+		p.send(event{
+			player: p,
+			output: "You don't have the key.",
+		})
+	default:
+		p.setDoor(dir, doorClosed, commands["unlock"], "unlock")
+	}
+}
+
+// Try to open a lock without the key
+func (p *player) doPick(cmd string) {
+	dir, d := p.doorCommand(cmd, "Usage: pick <direction|door>")
+	switch {
+	case d == nil:
+	case d.state != doorLocked:
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("The %s isn't locked.", d.name),
+		})
+	case d.pickproof || rand.Intn(100) >= pickChance:
+		p.send(event{
+			player: p,
+			output: "You failed to pick the lock.",
+		})
+	default:
+		p.setDoor(dir, doorClosed, commands["pick"], "unlock")
+	}
+}
@@ -2,4 +2,8 @@ module github.com/evad1n/mud
 
 go 1.15
 
-require github.com/mattn/go-sqlite3 v1.14.6
+require (
+	github.com/gorilla/websocket v1.4.2
+	github.com/mattn/go-sqlite3 v1.14.6
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
+)
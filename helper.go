@@ -73,6 +73,22 @@ func plural(num int, unit string) string {
 	return unit + "s"
 }
 
+// The smaller of two numbers
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// The larger of two numbers
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 // Returns current IPv4 address
 func getLocalAddress() string {
 	var localaddress string
@@ -106,3 +122,11 @@ func getLocalAddress() string {
 
 	return localaddress
 }
+
+// Parse a direction word like "n" or "north" into an exit index, or -1
+func parseDirection(word string) int {
+	if fullDir, exists := dirs[strings.ToLower(word)]; exists {
+		return dirRuneToInt[rune(fullDir[0])]
+	}
+	return -1
+}
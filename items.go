@@ -0,0 +1,321 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Load the items a player is carrying.
+// Runs on the world goroutine since it links to the objects table
+func (p *player) loadInventory() error {
+	p.inventory = nil
+	return readTransaction(func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT id, object_id FROM items WHERE owner = ? ORDER BY id", p.name)
+		if err != nil {
+			return fmt.Errorf("querying inventory: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id, objectID int
+			if err := rows.Scan(&id, &objectID); err != nil {
+				return fmt.Errorf("reading an item: %v", err)
+			}
+			if o, exists := objects[objectID]; exists {
+				p.inventory = append(p.inventory, &item{id: id, object: o})
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("iterating over inventory: %v", err)
+		}
+		return nil
+	})
+}
+
+// Record that an item now lies in a room
+func (it *item) saveInRoom(r *room) error {
+	return writeTransaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE items SET room_id = ?, owner = NULL WHERE id = ?", r.id, it.id)
+		return err
+	})
+}
+
+// Record that an item is now carried by a player
+func (it *item) saveCarried(p *player) error {
+	return writeTransaction(func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE items SET room_id = NULL, owner = ? WHERE id = ?", p.name, it.id)
+		return err
+	})
+}
+
+// Whether a word refers to this item, by prefix of any keyword
+func (it *item) matches(word string) bool {
+	word = strings.ToLower(word)
+	return contain(len(it.object.keywords), func(idx int) bool { return strings.HasPrefix(it.object.keywords[idx], word) })
+}
+
+// Find the first item a word refers to, or nil
+func findItem(items []*item, word string) *item {
+	if i := index(len(items), func(idx int) bool { return items[idx].matches(word) }); i != -1 {
+		return items[i]
+	}
+	return nil
+}
+
+// Remove an item from a list
+func removeItem(items []*item, it *item) []*item {
+	if i := index(len(items), func(idx int) bool { return items[idx] == it }); i != -1 {
+		return append(items[:i], items[i+1:]...)
+	}
+	return items
+}
+
+// List item names, grouping duplicates, e.g. "a torch, a loaf of bread (x2)"
+func listItems(items []*item) []string {
+	names := []string{}
+	order, counts := countItems(items)
+	for _, o := range order {
+		if n := counts[o]; n > 1 {
+			names = append(names, fmt.Sprintf("%s (x%d)", o.name, n))
+		} else {
+			names = append(names, o.name)
+		}
+	}
+	return names
+}
+
+// The lines describing items lying in a room, e.g. "A wooden torch lies on the ground."
+// Objects without one are only listed by name
+func groundItems(items []*item) []string {
+	lines := []string{}
+	order, counts := countItems(items)
+	for _, o := range order {
+		if o.ground == "" {
+			continue
+		}
+		if n := counts[o]; n > 1 {
+			lines = append(lines, fmt.Sprintf("%s (x%d)", o.ground, n))
+		} else {
+			lines = append(lines, o.ground)
+		}
+	}
+	return lines
+}
+
+// How many of each object there are, in the order they first appear
+func countItems(items []*item) ([]*object, map[*object]int) {
+	counts := make(map[*object]int)
+	order := []*object{}
+	for _, it := range items {
+		if counts[it.object] == 0 {
+			order = append(order, it.object)
+		}
+		counts[it.object]++
+	}
+	return order, counts
+}
+
+// Items
+
+// Pick up an item, or everything, from the room
+func (p *player) doGet(cmd string) {
+	words := strings.Fields(cmd)
+	if len(words) != 1 {
+		p.send(event{
+			player: p,
+			output: "Usage: get <item|all>",
+			err:    true,
+		})
+		return
+	}
+	var taking []*item
+	if strings.ToLower(words[0]) == "all" {
+		taking = append(taking, p.room.items...)
+	} else if it := findItem(p.room.items, words[0]); it != nil {
+		taking = append(taking, it)
+	}
+	if len(taking) == 0 {
+		p.send(event{
+			player: p,
+			output: "You don't see that here.",
+			err:    true,
+		})
+		return
+	}
+	for _, it := range taking {
+		if err := it.saveCarried(p); err != nil {
+			serverLog.Printf("saving item %d: %v", it.id, err)
+			p.send(event{
+				player: p,
+				output: "Something went wrong, you can't pick that up right now.",
+				err:    true,
+			})
+			return
+		}
+		p.room.items = removeItem(p.room.items, it)
+		p.inventory = append(p.inventory, it)
+		p.roomCommand(
+			commands["get"],
+			fmt.Sprintf("%s picks up %s", p.name, it.object.name),
+			fmt.Sprintf("You pick up %s", it.object.name),
+		)
+	}
+}
+
+// Put down an item, or everything, in the room
+func (p *player) doDrop(cmd string) {
+	words := strings.Fields(cmd)
+	if len(words) != 1 {
+		p.send(event{
+			player: p,
+			output: "Usage: drop <item|all>",
+			err:    true,
+		})
+		return
+	}
+	var dropping []*item
+	if strings.ToLower(words[0]) == "all" {
+		dropping = append(dropping, p.inventory...)
+	} else if it := findItem(p.inventory, words[0]); it != nil {
+		dropping = append(dropping, it)
+	}
+	if len(dropping) == 0 {
+		p.send(event{
+			player: p,
+			output: "You aren't carrying that.",
+			err:    true,
+		})
+		return
+	}
+	for _, it := range dropping {
+		if err := it.saveInRoom(p.room); err != nil {
+			serverLog.Printf("saving item %d: %v", it.id, err)
+			p.send(event{
+				player: p,
+				output: "Something went wrong, you can't drop that right now.",
+				err:    true,
+			})
+			return
+		}
+		p.inventory = removeItem(p.inventory, it)
+		p.room.items = append(p.room.items, it)
+		p.roomCommand(
+			commands["drop"],
+			fmt.Sprintf("%s drops %s", p.name, it.object.name),
+			fmt.Sprintf("You drop %s", it.object.name),
+		)
+	}
+}
+
+// Hand an item to another player in the room
+func (p *player) doGive(cmd string) {
+	words := strings.Fields(cmd)
+	if len(words) != 2 {
+		p.send(event{
+			player: p,
+			output: "Usage: give <item> <player name>",
+			err:    true,
+		})
+		return
+	}
+	it := findItem(p.inventory, words[0])
+	if it == nil {
+		p.send(event{
+			player: p,
+			output: "You aren't carrying that.",
+			err:    true,
+		})
+		return
+	}
+	name := words[1]
+	idx := index(len(p.room.players), func(i int) bool { return strings.EqualFold(p.room.players[i].name, name) })
+	if idx == -1 {
+		p.send(event{
+			player: p,
+			output: "No such player in this room!",
+			err:    true,
+		})
+		return
+	}
+	other := p.room.players[idx]
+	if other == p {
+		p.send(event{
+			player: p,
+			output: "You pass it from one hand to the other. Very impressive.",
+		})
+		return
+	}
+	if err := it.saveCarried(other); err != nil {
+		serverLog.Printf("saving item %d: %v", it.id, err)
+		p.send(event{
+			player: p,
+			output: "Something went wrong, you can't give that right now.",
+			err:    true,
+		})
+		return
+	}
+	p.inventory = removeItem(p.inventory, it)
+	other.inventory = append(other.inventory, it)
+	other.send(event{
+		player:  p,
+		output:  fmt.Sprintf("%s gives you %s", p.name, it.object.name),
+		command: commands["give"],
+	})
+	p.send(event{
+		player:  p,
+		output:  fmt.Sprintf("You give %s to %s", it.object.name, other.name),
+		command: commands["give"],
+	})
+}
+
+// List what the player is carrying
+func (p *player) doInventory(_ string) {
+	output := "You are carrying:\n"
+	if len(p.inventory) == 0 {
+		output += "  Nothing at all"
+	}
+	names := listItems(p.inventory)
+	sort.Strings(names)
+	output += "  " + strings.Join(names, "\n  ")
+	p.send(event{
+		player: p,
+		output: strings.TrimRight(output, " \n"),
+	})
+}
+
+// Describe an item being carried or lying in the room, or a mobile
+func (p *player) doExamine(cmd string) {
+	words := strings.Fields(cmd)
+	if len(words) != 1 {
+		p.send(event{
+			player: p,
+			output: "Usage: examine <item|mobile>",
+			err:    true,
+		})
+		return
+	}
+	it := findItem(p.inventory, words[0])
+	if it == nil {
+		it = findItem(p.room.items, words[0])
+	}
+	if it != nil {
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("%s\n\n%s", it.object.name, it.object.description),
+		})
+		return
+	}
+	if m := p.room.findMob(words[0]); m != nil {
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("%s\n\n%s", capitalize(m.mobile.name), m.mobile.description),
+		})
+		return
+	}
+	p.send(event{
+		player: p,
+		output: "You don't see that here.",
+		err:    true,
+	})
+}
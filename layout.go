@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	maxStretch = 40 // How far a sheet may be stretched along one axis before rooms go on a sheet of their own
+	stubRange  = 3  // How far from a room it leads to a room left on a sheet by itself may be put
+)
+
+type (
+	// Where a room is drawn. Each step up or down is a level of its own,
+	// and rooms that can't be fitted in with the others are moved to a sheet of their own
+	place struct {
+		sheet   int
+		x, y, z int
+	}
+
+	// One level of one sheet, drawn as a map by itself
+	layer struct {
+		sheet, z int
+	}
+
+	// The places of the rooms of a zone, relative to a starting room
+	layout struct {
+		places    map[int]place   // By room id
+		rooms     map[place]*room // The room at each place
+		order     []*room         // In the order they were placed, so drawings come out the same every time
+		sheets    int
+		stretches map[int][3]int // How many times each sheet was stretched along x, y and z
+	}
+)
+
+// Lay out the rooms of a zone that can be reached from start through visited rooms
+func newLayout(start *room, visited map[int]bool) *layout {
+	l := &layout{
+		places:    make(map[int]place),
+		rooms:     make(map[place]*room),
+		stretches: make(map[int][3]int),
+	}
+	l.add(start, visited)
+	l.mergeStubs()
+	return l
+}
+
+// Lay out every visited room of start's zone: first those that can be reached from start,
+// then each one left over along with what can be reached from it, in order of room id
+func newZoneLayout(start *room, visited map[int]bool) *layout {
+	l := newLayout(start, visited)
+	sorted := append([]*room{}, start.zone.rooms...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+	for _, r := range sorted {
+		if _, placed := l.places[r.id]; visited[r.id] && !placed {
+			l.add(r, visited)
+		}
+	}
+	l.mergeStubs()
+	return l
+}
+
+// Lay out start on a new sheet, and the rooms of its zone that can be reached from it through visited rooms.
+// Each room goes a step from the room that first led to it, in the direction of the exit.
+// When that place is taken, the sheet is stretched to make room, and only if it has been stretched too far
+// does the room start a new sheet instead of being drawn over the other
+func (l *layout) add(start *room, visited map[int]bool) {
+	l.put(start, place{sheet: l.sheets})
+	l.sheets++
+	q := []*room{start}
+	for len(q) > 0 {
+		r := q[0]
+		q = q[1:]
+		for dir, e := range r.exits {
+			target := e.to
+			if target == nil || !e.visible() || target.zone != r.zone || !visited[target.id] {
+				continue
+			}
+			if _, placed := l.places[target.id]; placed {
+				continue
+			}
+			at := l.places[r.id].step(dir)
+			if l.rooms[at] != nil && !l.stretch(at, dir) {
+				at = place{sheet: l.sheets}
+				l.sheets++
+			}
+			l.put(target, at)
+			q = append(q, target)
+		}
+	}
+}
+
+func (l *layout) put(r *room, at place) {
+	l.places[r.id] = at
+	l.rooms[at] = r
+	l.order = append(l.order, r)
+}
+
+// Free a place by moving every room of its sheet at or beyond it a step further in a direction.
+// Exits across the gap this opens still run in a straight line, see reach.
+// Returns false if the sheet has already been stretched too far that way
+func (l *layout) stretch(from place, dir int) bool {
+	axis := [...]int{1, 0, 0, 1, 2, 2}[dir]
+	counts := l.stretches[from.sheet]
+	if counts[axis] >= maxStretch {
+		return false
+	}
+	counts[axis]++
+	l.stretches[from.sheet] = counts
+
+	moved := make(map[*room]place)
+	for at, r := range l.rooms {
+		if at.sheet == from.sheet && at.beyond(from, dir) {
+			moved[r] = at.step(dir)
+			delete(l.rooms, at)
+		}
+	}
+	for r, at := range moved {
+		l.places[r.id] = at
+		l.rooms[at] = r
+	}
+	return true
+}
+
+// How many steps an exit runs in a straight line to the room it leads to, over places with no room in them.
+// Zero if the room isn't drawn that way from this one
+func (l *layout) reach(r *room, dir int) int {
+	target := r.exits[dir].to
+	there, placed := l.places[target.id]
+	if !placed {
+		return 0
+	}
+	at := l.places[r.id]
+	for steps := 1; at.sheet == there.sheet && at.toward(there, dir); steps++ {
+		if at = at.step(dir); at == there {
+			return steps
+		}
+		if l.rooms[at] != nil {
+			return 0
+		}
+	}
+	return 0
+}
+
+// Put rooms left on a sheet by themselves next to a room they are joined to, so they don't get a map of their own.
+// Their exits are drawn as leading elsewhere on the map
+func (l *layout) mergeStubs() {
+	counts := make(map[int]int)
+	for _, at := range l.places {
+		counts[at.sheet]++
+	}
+	for _, r := range l.order {
+		at := l.places[r.id]
+		if at.sheet == 0 || counts[at.sheet] != 1 {
+			continue
+		}
+		if to, found := l.stubPlace(r); found {
+			delete(l.rooms, at)
+			l.places[r.id] = to
+			l.rooms[to] = r
+			counts[at.sheet]--
+			counts[to.sheet]++
+		}
+	}
+
+	// Number the sheets left from 0 again
+	renumber := make(map[int]int)
+	for _, r := range l.order {
+		if sheet := l.places[r.id].sheet; counts[sheet] > 0 {
+			if _, exists := renumber[sheet]; !exists {
+				renumber[sheet] = len(renumber)
+			}
+		}
+	}
+	l.rooms = make(map[place]*room)
+	for _, r := range l.order {
+		at := l.places[r.id]
+		at.sheet = renumber[at.sheet]
+		l.places[r.id] = at
+		l.rooms[at] = r
+	}
+	l.sheets = len(renumber)
+}
+
+// A free place near a room on another sheet that r has an exit to, or that has an exit to r.
+// Rooms on the first sheet are tried first, and a room with no exits at all goes under the first sheet
+func (l *layout) stubPlace(r *room) (place, bool) {
+	home := l.places[r.id].sheet
+	neighbours := []place{}
+	for _, other := range l.order {
+		at := l.places[other.id]
+		if at.sheet == home {
+			continue
+		}
+		for dir := range other.exits {
+			if other.exits[dir].to == r || r.exits[dir].to == other {
+				neighbours = append(neighbours, at)
+				break
+			}
+		}
+	}
+	sort.SliceStable(neighbours, func(i, j int) bool { return neighbours[i].sheet < neighbours[j].sheet })
+	for _, near := range neighbours {
+		// Closest first, in rings around the neighbour
+		for d := 1; d <= stubRange; d++ {
+			for dy := d; dy >= -d; dy-- {
+				for dx := -d; dx <= d; dx++ {
+					if max(dx, -dx) != d && max(dy, -dy) != d {
+						continue
+					}
+					at := place{sheet: near.sheet, x: near.x + dx, y: near.y + dy, z: near.z}
+					if l.rooms[at] == nil {
+						return at, true
+					}
+				}
+			}
+		}
+	}
+	if len(neighbours) > 0 {
+		return place{}, false
+	}
+	left, bottom := 0, 0
+	for at := range l.rooms {
+		if at.layer() == (layer{}) {
+			left, bottom = min(left, at.x), min(bottom, at.y)
+		}
+	}
+	at := place{x: left, y: bottom - 2}
+	for l.rooms[at] != nil {
+		at.x += 2
+	}
+	return at, true
+}
+
+// Every layer with a room on it, the start's first and then by sheet from the top level down
+func (l *layout) layers() []layer {
+	seen := map[layer]bool{{}: true}
+	layers := []layer{}
+	for _, at := range l.places {
+		if !seen[at.layer()] {
+			seen[at.layer()] = true
+			layers = append(layers, at.layer())
+		}
+	}
+	sort.Slice(layers, func(i, j int) bool {
+		if layers[i].sheet != layers[j].sheet {
+			return layers[i].sheet < layers[j].sheet
+		}
+		return layers[i].z > layers[j].z
+	})
+	return append([]layer{{}}, layers...)
+}
+
+// The place a step away in a direction
+func (at place) step(dir int) place {
+	switch dir {
+	case 4:
+		at.z++
+	case 5:
+		at.z--
+	default:
+		at.x += dxByIndex[dir]
+		at.y += dyByIndex[dir]
+	}
+	return at
+}
+
+// Whether a place is at or past another in a direction, on any row, column or level
+func (at place) beyond(from place, dir int) bool {
+	switch dir {
+	case 0:
+		return at.y >= from.y
+	case 1:
+		return at.x >= from.x
+	case 2:
+		return at.x <= from.x
+	case 3:
+		return at.y <= from.y
+	case 4:
+		return at.z >= from.z
+	default:
+		return at.z <= from.z
+	}
+}
+
+// Whether another place lies further on in a straight line in a direction
+func (at place) toward(there place, dir int) bool {
+	next := at.step(dir)
+	switch dir {
+	case 0, 3:
+		return there.x == at.x && there.z == at.z && next.beyond(there, oppositeDirction[dir])
+	case 1, 2:
+		return there.y == at.y && there.z == at.z && next.beyond(there, oppositeDirction[dir])
+	default:
+		return there.x == at.x && there.y == at.y && next.beyond(there, oppositeDirction[dir])
+	}
+}
+
+func (at place) layer() layer {
+	return layer{at.sheet, at.z}
+}
+
+// The name of a layer, counting levels from the start's
+func (on layer) String() string {
+	name := "level 0"
+	if on.z != 0 {
+		name = fmt.Sprintf("level %+d", on.z)
+	}
+	if on.sheet > 0 {
+		name += fmt.Sprintf(", part %d", on.sheet+1)
+	}
+	return name
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// How serious a lint issue is
+const (
+	lintError   = "error"   // The world can't be loaded as written
+	lintWarning = "warning" // Probably a mistake
+	lintNote    = "note"    // Worth knowing, often intended
+)
+
+type (
+	// A problem found in the world's layout
+	lintIssue struct {
+		Severity string `json:"severity"`
+		Check    string `json:"check"`
+		Room     int    `json:"room,omitempty"`
+		Zone     int    `json:"zone,omitempty"`
+		Message  string `json:"message"`
+	}
+
+	// The world tables as stored, before anything is linked together
+	worldRows struct {
+		zones map[int]string
+		rooms map[int]roomRow
+		exits []exitRow
+	}
+
+	roomRow struct {
+		zone int
+		name string
+	}
+
+	exitRow struct {
+		from, to int
+		dir      string
+	}
+)
+
+// Read zones, rooms and exits without linking them, so broken rows can be reported
+func readWorldRows(tx *sql.Tx) (*worldRows, error) {
+	w := &worldRows{
+		zones: make(map[int]string),
+		rooms: make(map[int]roomRow),
+	}
+	rows, err := tx.Query("SELECT id, name FROM zones")
+	if err != nil {
+		return nil, fmt.Errorf("querying zones: %v", err)
+	}
+	for rows.Next() {
+		var (
+			id   int
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("reading a zone: %v", err)
+		}
+		w.zones[id] = name
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating over zones: %v", err)
+	}
+
+	rows, err = tx.Query("SELECT id, zone_id, name FROM rooms")
+	if err != nil {
+		return nil, fmt.Errorf("querying rooms: %v", err)
+	}
+	for rows.Next() {
+		var (
+			id int
+			r  roomRow
+		)
+		if err := rows.Scan(&id, &r.zone, &r.name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("reading a room: %v", err)
+		}
+		w.rooms[id] = r
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating over rooms: %v", err)
+	}
+
+	rows, err = tx.Query("SELECT from_room_id, to_room_id, direction FROM exits ORDER BY from_room_id, direction")
+	if err != nil {
+		return nil, fmt.Errorf("querying exits: %v", err)
+	}
+	for rows.Next() {
+		var e exitRow
+		if err := rows.Scan(&e.from, &e.to, &e.dir); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("reading an exit: %v", err)
+		}
+		w.exits = append(w.exits, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating over exits: %v", err)
+	}
+	return w, nil
+}
+
+// Whether a direction abbreviation from the database is one we know
+func validDirection(dir string) bool {
+	if len(dir) != 1 {
+		return false
+	}
+	_, known := dirRuneToInt[rune(dir[0])]
+	return known
+}
+
+// Check the world for layout problems. Rooms are reachable if they can be walked to from start
+func lintWorld(w *worldRows, start int) []lintIssue {
+	issues := []lintIssue{}
+	report := func(severity string, check string, room int, zone int, format string, a ...interface{}) {
+		issues = append(issues, lintIssue{
+			Severity: severity,
+			Check:    check,
+			Room:     room,
+			Zone:     zone,
+			Message:  fmt.Sprintf(format, a...),
+		})
+	}
+
+	// Exits by room and direction, only the ones that can be loaded
+	exits := make(map[int]map[int]int)
+	for _, e := range w.exits {
+		_, fromExists := w.rooms[e.from]
+		_, toExists := w.rooms[e.to]
+		switch {
+		case !fromExists:
+			report(lintError, "dangling-exit", e.from, 0, "exit %s from missing room %d", e.dir, e.from)
+		case !toExists:
+			report(lintError, "dangling-exit", e.from, 0, "exit %s from room %d leads to missing room %d", e.dir, e.from, e.to)
+		case !validDirection(e.dir):
+			report(lintError, "bad-direction", e.from, 0, "exit from room %d has unknown direction %q", e.from, e.dir)
+		default:
+			if exits[e.from] == nil {
+				exits[e.from] = make(map[int]int)
+			}
+			exits[e.from][dirRuneToInt[rune(e.dir[0])]] = e.to
+		}
+	}
+	ids := make([]int, 0, len(w.rooms))
+	for id, r := range w.rooms {
+		ids = append(ids, id)
+		if _, exists := w.zones[r.zone]; !exists {
+			report(lintError, "missing-zone", id, r.zone, "room %d is in missing zone %d", id, r.zone)
+		}
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		for dir := 0; dir < 6; dir++ {
+			to, exists := exits[id][dir]
+			if !exists {
+				continue
+			}
+			name := dirs[string(dirIntToRune[dir])]
+			// A way back in the opposite direction that is free looks like it was forgotten
+			if _, taken := exits[to][oppositeDirction[dir]]; !taken && !leadsTo(exits[to], id) {
+				report(lintWarning, "one-way-exit", id, 0, "exit %s from room %d to room %d has no way back", name, id, to)
+			}
+			if from, dest := w.rooms[id].zone, w.rooms[to].zone; from != dest {
+				report(lintNote, "cross-zone-exit", id, from, "exit %s from room %d in zone %d leads to room %d in zone %d", name, id, from, to, dest)
+			}
+		}
+	}
+
+	if _, exists := w.rooms[start]; !exists {
+		report(lintError, "missing-start", start, 0, "start room %d does not exist", start)
+	} else {
+		reached := map[int]bool{start: true}
+		q := []int{start}
+		for len(q) > 0 {
+			here := q[0]
+			q = q[1:]
+			for _, to := range exits[here] {
+				if !reached[to] {
+					reached[to] = true
+					q = append(q, to)
+				}
+			}
+		}
+		for _, id := range ids {
+			if !reached[id] {
+				report(lintWarning, "unreachable-room", id, w.rooms[id].zone, "room %d, %s, can't be reached from room %d", id, w.rooms[id].name, start)
+			}
+		}
+	}
+
+	zoneIDs := make([]int, 0, len(w.zones))
+	for id := range w.zones {
+		zoneIDs = append(zoneIDs, id)
+	}
+	sort.Ints(zoneIDs)
+	roomCount := make(map[int]int)
+	for _, r := range w.rooms {
+		roomCount[r.zone]++
+	}
+	for _, id := range zoneIDs {
+		if roomCount[id] == 0 {
+			report(lintWarning, "empty-zone", 0, id, "zone %d, %s, has no rooms", id, w.zones[id])
+		}
+	}
+
+	// Rooms with the same name in one zone are hard to tell apart
+	named := make(map[string][]int)
+	for _, id := range ids {
+		key := fmt.Sprintf("%d\x00%s", w.rooms[id].zone, strings.ToLower(w.rooms[id].name))
+		named[key] = append(named[key], id)
+	}
+	for _, id := range ids {
+		key := fmt.Sprintf("%d\x00%s", w.rooms[id].zone, strings.ToLower(w.rooms[id].name))
+		if same := named[key]; len(same) > 1 && same[0] == id {
+			report(lintNote, "duplicate-name", id, w.rooms[id].zone, "%d rooms in zone %d are named %s: %s", len(same), w.rooms[id].zone, w.rooms[id].name, joinInts(same))
+		}
+	}
+	return issues
+}
+
+// Whether any exit in a set leads to a room
+func leadsTo(exits map[int]int, id int) bool {
+	for _, to := range exits {
+		if to == id {
+			return true
+		}
+	}
+	return false
+}
+
+func joinInts(nums []int) string {
+	s := make([]string, len(nums))
+	for i, n := range nums {
+		s[i] = fmt.Sprint(n)
+	}
+	return strings.Join(s, ", ")
+}
+
+// Log the problems with the world that should be fixed
+func logLint(tx *sql.Tx) error {
+	w, err := readWorldRows(tx)
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int)
+	for _, issue := range lintWorld(w, cfg.StartRoom) {
+		counts[issue.Severity]++
+		if issue.Severity == lintError {
+			serverLog.Printf("World %s: %s", issue.Severity, issue.Message)
+		}
+	}
+	if counts[lintError]+counts[lintWarning] > 0 {
+		serverLog.Printf("World check found %d %s and %d %s, run 'mud lint' for details",
+			counts[lintError], plural(counts[lintError], "error"), counts[lintWarning], plural(counts[lintWarning], "warning"))
+	}
+	return nil
+}
+
+// The 'lint' subcommand: check a world database and print what is wrong with it.
+// Returns the exit status, 1 if there are errors
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("mud lint", flag.ContinueOnError)
+	path := flags.String("db", cfg.Database, "path to the world database")
+	start := flags.Int("start", cfg.StartRoom, "room id every room should be reachable from")
+	asJSON := flags.Bool("json", false, "print issues as JSON")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	createMaps()
+
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "opening database: %v\n", err)
+		return 2
+	}
+	var err error
+	db, err = sql.Open("sqlite3", *path+"?_busy_timeout=10000&mode=ro")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opening database: %v\n", err)
+		return 2
+	}
+	defer db.Close()
+	var issues []lintIssue
+	err = readTransaction(func(tx *sql.Tx) error {
+		w, err := readWorldRows(tx)
+		if err != nil {
+			return err
+		}
+		issues = lintWorld(w, *start)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reading world: %v\n", err)
+		return 2
+	}
+
+	counts := make(map[string]int)
+	for _, issue := range issues {
+		counts[issue.Severity]++
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(issues, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, issue := range issues {
+			fmt.Printf("%-7s %-16s %s\n", issue.Severity, issue.Check, issue.Message)
+		}
+		fmt.Printf("%d %s, %d %s, %d %s\n",
+			counts[lintError], plural(counts[lintError], "error"),
+			counts[lintWarning], plural(counts[lintWarning], "warning"),
+			counts[lintNote], plural(counts[lintNote], "note"))
+	}
+	if counts[lintError] > 0 {
+		return 1
+	}
+	return 0
+}
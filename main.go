@@ -1,31 +1,59 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
-	"net"
+	"math/rand"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
-const (
-	port = "9001"
-)
-
 var (
 	serverAddress string
 	serverLog     *log.Logger
 	eventLog      *log.Logger
-	players       map[string]*player // All players on the server
+	players       map[string]*player  // All players on the server
+	finished      = make(chan func()) // Work done on other goroutines reports back through here, to run on the main goroutine
+	// Tools run as 'mud <name>' instead of starting the server
+	subcommands = map[string]func(args []string) int{
+		"lint":          runLint,
+		"import-circle": runCircleImport,
+		"export":        runExport,
+		"import":        runImport,
+		"map-image":     runMapImage,
+	}
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, exists := subcommands[os.Args[1]]; exists {
+			// Tools have no server log, so it goes to stderr
+			serverLog = log.New(os.Stderr, "", 0)
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+	if err := loadConfig(os.Args[1:]); err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	// Mobiles wander randomly
+	rand.Seed(time.Now().UnixNano())
+
 	// Get local IP
 	serverAddress = getLocalAddress()
 
 	// Create server log
-	serverLog = log.New(os.Stdout, "SERVER: ", log.Ldate|log.Ltime)
+	serverOut, err := logOutput(cfg.ServerLog)
+	if err != nil {
+		log.Fatalf("opening server log: %v", err)
+	}
+	serverLog = log.New(serverOut, "SERVER: ", log.Ldate|log.Ltime)
 	serverLog.SetPrefix("SERVER: ")
 	serverLog.Println("Starting MUD server...")
 
@@ -39,39 +67,101 @@ func main() {
 	inputs := make(chan input)
 
 	go listenConnections(inputs)
+	if cfg.Web != "" {
+		go listenWeb(inputs)
+	}
 
 	// Create event log
-	eventLog = log.New(os.Stdout, "EVENT: ", log.Ltime)
+	eventOut, err := logOutput(cfg.EventLog)
+	if err != nil {
+		serverLog.Fatalf("opening event log: %v", err)
+	}
+	eventLog = log.New(eventOut, "EVENT: ", log.Ltime)
+
+	// Pick up players kept connected through a copyover
+	restoreCopyover(inputs)
+
+	// Timed world events
+	sched = newScheduler(systemClock{})
+	startPulses()
+	pulses := time.NewTicker(pulseInterval)
+	defer pulses.Stop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}, rebootSignals...)...)
 
 	for {
-		// Get input
-		ev := <-inputs
-		// Check for closed connection
-		if ev.end {
-			if ev.player.events != nil {
-				ev.player.disconnect()
-			} else {
-				// Already shutting down -> ignore
-				serverLog.Printf("player '%s' connection already closed\n", ev.player.name)
+		select {
+		case ev := <-inputs:
+			handleInput(ev)
+		case <-pulses.C:
+			sched.run()
+		case report := <-finished:
+			report()
+		case sig := <-signals:
+			serverLog.Printf("Received signal: %v", sig)
+			if sig == syscall.SIGHUP {
+				reloadAndReport(nil)
+				continue
 			}
-			continue
+			beginShutdown(isRebootSignal(sig))
 		}
-		// Otherwise process commands
-		if words := strings.Fields(ev.text); len(words) > 0 {
-			// Check if cmd exists
-			if validCmd, exists := commands[strings.ToLower(words[0])]; exists {
-				params := strings.Join(words[1:], " ")
-				// Log to server
-				eventLog.Printf("PLAYER: %s | COMMAND: %s | PARAMS: %s\n", ev.player.name, validCmd.name, params)
-				// Actually run the command
-				validCmd.run(ev.player, params)
-			} else {
-				ev.player.events <- event{
-					player: ev.player,
-					output: "Unrecognized command!",
+	}
+}
+
+// Process a message from a player's connection.
+// This runs on the main goroutine, which is the only one allowed to touch the world
+func handleInput(ev input) {
+	// New player logging in
+	if ev.join != nil {
+		ev.join <- ev.player.enterWorld()
+		return
+	}
+	// Check for closed connection
+	if ev.end {
+		if ev.player.events != nil {
+			if ev.text != "" {
+				serverLog.Printf("Client %s connection error: %s", ev.player.conn.RemoteAddr().String(), ev.text)
+			}
+			if ev.idle {
+				serverLog.Printf("player '%s' idle for %v", ev.player.name, time.Duration(cfg.IdleTimeout))
+				ev.player.send(event{
+					output: "You have been idle too long, goodbye!",
 					err:    true,
-				}
+				})
 			}
+			ev.player.disconnect()
+		} else {
+			// Already shutting down -> ignore
+			serverLog.Printf("player '%s' connection already closed\n", ev.player.name)
+		}
+		return
+	}
+	// Ignore anything still arriving from a player who has quit
+	if ev.player.events == nil {
+		return
+	}
+	// Typing anything interrupts a travel route
+	ev.player.stopTravel("You stop traveling.")
+	// Otherwise process commands
+	if words := strings.Fields(ev.text); len(words) > 0 {
+		if steps, ok := lineSpeedwalk(ev.text); ok {
+			// A string of directions like "3n2e u w"
+			eventLog.Printf("PLAYER: %s | COMMAND: speedwalk | PARAMS: %s\n", ev.player.name, strings.TrimSpace(ev.text))
+			ev.player.speedwalk(steps)
+		} else if validCmd, exists := commands[strings.ToLower(words[0])]; exists && validCmd.rank <= ev.player.rank {
+			// Commands above the player's rank are treated as unknown
+			params := strings.Join(words[1:], " ")
+			// Log to server
+			eventLog.Printf("PLAYER: %s | COMMAND: %s | PARAMS: %s\n", ev.player.name, validCmd.name, params)
+			// Actually run the command
+			validCmd.run(ev.player, params)
+		} else {
+			ev.player.send(event{
+				player: ev.player,
+				output: "Unrecognized command!",
+				err:    true,
+			})
 		}
 	}
 }
@@ -80,55 +170,92 @@ func main() {
 func initWorld() {
 	createMaps()
 	defaultCommands()
+	defaultPreferences()
 	if err := loadWorld(); err != nil {
 		serverLog.Fatal(fmt.Errorf("loading world from database: %v", err))
 	}
-}
-
-// Create a player and add it to the global players map
-func createPlayer(name string, conn net.Conn, log *log.Logger) (*player, error) {
-	if _, exists := players[name]; exists {
-		return nil, fmt.Errorf("That username is taken")
+	if err := checkConfigRooms(); err != nil {
+		serverLog.Fatal(err)
 	}
+}
 
-	p := &player{
+// Create a player that is not yet part of the world
+func newPlayer(name string, conn *telnetConn, log *log.Logger) *player {
+	return &player{
 		name:      name,
 		conn:      conn,
 		log:       log,
-		events:    make(chan event),
 		beginTime: time.Now(),
 		zone:      nil,
 		room:      nil,
-		minimap:   newMapBuilder(4),
+		minimap:   newMapBuilder(cfg.MapDepth),
 		visited:   make(map[int]bool),
+		prefs:     make(map[string]string),
+		stats:     startingStats,
+		bookmarks: make(map[string]int),
+		colors:    make(map[string]string),
+	}
+}
+
+// Add a logged in player to the global players map and place them in the world
+func (p *player) enterWorld() error {
+	if _, exists := players[p.name]; exists {
+		return fmt.Errorf("%s is already playing", p.name)
+	}
+	// Items link to objects, which only the world goroutine may read
+	if err := p.loadInventory(); err != nil {
+		serverLog.Printf("loading inventory for '%s': %v", p.name, err)
+		return fmt.Errorf("Unable to load your character, please try again later")
 	}
 	// Add to data
 	players[p.name] = p
+	p.events = make(chan event, outputQueueSize)
+
+	// The saved room may have been removed since
+	start, exists := rooms[p.lastRoom]
+	if !exists {
+		start = rooms[cfg.StartRoom]
+	}
+	p.joinServer(start)
+
+	// The minimap must be in place before the client starts drawing
+	p.view = *p.minimap.snapshot(p.room, p.visited)
+	p.screen = p.display
+	writers.Add(1)
+	go p.listenMUD()
 
-	return p, nil
+	serverLog.Printf("player '%s' joined the MUD from %s", p.name, p.conn.RemoteAddr().String())
+
+	p.printLocation()
+
+	p.send(event{
+		player:      nil,
+		output:      "Type 'help' to see all available commands!",
+		unsolicited: true,
+	})
+	return nil
 }
 
-// Move to starting room (Temple of Midgaard)
+// Move to the starting room
 // Notify other players
-func (p *player) joinServer() {
-	r := rooms[3001]
+func (p *player) joinServer(r *room) {
 
 	// Notify players on server of new join
 	for _, other := range players {
 		if other != p {
-			other.events <- event{
+			other.send(event{
 				player: p,
 				output: fmt.Sprintf("%s has joined the server", p.name),
-			}
+			})
 		}
 	}
 
 	// Notify other players in starting room
 	for _, other := range r.players {
-		other.events <- event{
+		other.send(event{
 			player: p,
 			output: fmt.Sprintf("%s has entered the room", p.name),
-		}
+		})
 	}
 
 	p.room = r
@@ -138,7 +265,5 @@ func (p *player) joinServer() {
 
 	p.room.sortPlayers()
 
-	// Update map
 	p.visited[p.room.id] = true
-	p.minimap.trace(p.room, p.visited)
 }
@@ -9,6 +9,12 @@ type (
 		x, y int
 	}
 
+	// A rendered minimap, safe to hand to another goroutine
+	mapView struct {
+		width int // The width of the drawn map in characters
+		lines []string
+	}
+
 	mapBuilder struct {
 		depth  int
 		width  int // The width of the drawn map in characters
@@ -34,6 +40,8 @@ var (
 	inZoneArrows     = []rune{'↑', '→', '←', '↓', '⮭', '⮮'}
 	unknownArrows    = []rune{'⇧', '⇨', '⇦', '⇩', '⮭', '⮮'}
 	outZoneArrows    = []rune{'⇑', '⇒', '⇐', '⇓', '⇗', '⇙'}
+	warpArrows       = []rune{'⇡', '⇢', '⇠', '⇣', '⇞', '⇟'}
+	doorGlyphs       = []rune{'#', '#', '#', '#', '#', '#', '#', '#'}
 	oppositeDirction = []int{3, 2, 1, 0, 5, 4}
 	dxByIndex        = []int{0, 1, -1, 0}
 	dyByIndex        = []int{1, 0, 0, -1}
@@ -49,90 +57,108 @@ func newMapBuilder(depth int) *mapBuilder {
 	}
 }
 
+// Lay out the rooms around start and draw the level it is on
 func (m *mapBuilder) trace(start *room, visited map[int]bool) {
+	m.drawLayer(newLayout(start, visited), layer{}, start, visited)
+}
+
+// Draw the rooms of one layer of a layout that are within the depth of its origin, with a cross on mark
+func (m *mapBuilder) drawLayer(l *layout, on layer, mark *room, visited map[int]bool) {
 	// Clear
 	m.text = make(map[pair]rune)
 	m.grid = make(map[pair]*room)
-	m.grid[pair{0, 0}] = start
-	q := []pair{{0, 0}}
-
-	for len(q) > 0 {
-		here := q[0]
-		r := m.grid[here]
-		// Pop off queue
-		q = q[1:]
-
+	drawn := []*room{}
+	for _, r := range l.order {
+		at := l.places[r.id]
 		// The limits of the drawn map
-		if here.x > m.depth || here.x < -m.depth || here.y > m.depth || here.y < -m.depth {
+		if at.layer() != on || at.x > m.depth || at.x < -m.depth || at.y > m.depth || at.y < -m.depth {
 			continue
 		}
+		m.grid[pair{at.x, at.y}] = r
+		drawn = append(drawn, r)
+	}
+
+	for _, r := range drawn {
+		at := l.places[r.id]
+		here := pair{at.x, at.y}
 		m.drawBox(here)
+		if r == mark {
+			x, y := textCoords(here)
+			m.text[pair{x, y}] = cross
+		}
 
-		// Draw exits and follow
+		// Draw exits
 		for forward := 0; forward < 6; forward++ {
 			backward := oppositeDirction[forward]
 			var target *room
-			if target = r.exits[forward].to; target == nil {
+			if target = r.exits[forward].to; target == nil || !r.exits[forward].visible() {
 				continue
 			}
-
-			_, seen := visited[target.id]
-
-			var (
-				existing, back *room
-				dx, dy         int
-			)
-			if forward < 4 {
-				dx, dy = dxByIndex[forward], dyByIndex[forward]
-				existing = m.grid[pair{here.x + dx, here.y + dy}]
+			// Closed doors replace whichever arrow would be drawn
+			arrows := func(set []rune) []rune {
+				if r.exits[forward].blocked() {
+					return doorGlyphs
+				}
+				return set
+			}
+			back := target.exits[backward].to
+			reach := l.reach(r, forward)
+			if reach > 1 && forward < 4 {
+				m.drawPassage(here, forward, reach)
 			}
-			back = target.exits[backward].to
 
 			switch {
 			case r.zone != target.zone:
-				m.drawExit(here, outZoneArrows[forward], forward)
-			case !seen:
-				m.drawExit(here, unknownArrows[forward], forward)
+				m.drawExit(here, arrows(outZoneArrows)[forward], forward)
+			case !visited[target.id]:
+				m.drawExit(here, arrows(unknownArrows)[forward], forward)
+			case reach == 0:
+				// Leads somewhere the map can't put next to this room
+				m.drawExit(here, arrows(warpArrows)[forward], forward)
+			case r != back:
+				m.drawExit(here, arrows(inZoneArrows)[forward], forward)
 			case forward >= 4:
-				if r == back {
-					m.drawExit(here, biArrows[forward], forward)
-					m.drawExit(here, biArrows[forward+2], forward+2)
-				} else {
-					m.drawExit(here, inZoneArrows[forward], forward)
-				}
-			case existing == nil:
-				loc := pair{here.x + dx, here.y + dy}
-				m.grid[loc] = target
-				q = append(q, loc)
-
-				fallthrough
-			case existing == target:
-				if r == back {
-					m.drawExit(here, biArrows[forward], forward)
-				} else {
-					m.drawExit(here, inZoneArrows[forward], forward)
-				}
+				m.drawExit(here, arrows(biArrows)[forward], forward)
+				m.drawExit(here, arrows(biArrows)[forward+2], forward+2)
 			default:
-				m.drawExit(here, inZoneArrows[forward], forward)
+				m.drawExit(here, arrows(biArrows)[forward], forward)
 			}
 		}
 	}
 }
 
+// Retrace the map and render a snapshot of it
+func (m *mapBuilder) snapshot(start *room, visited map[int]bool) *mapView {
+	m.trace(start, visited)
+	return &mapView{
+		width: m.width,
+		lines: m.render(),
+	}
+}
+
 func (m *mapBuilder) render() []string {
+	return renderText(m.text, -m.depth*xScale-3, m.depth*xScale+3, m.depth*yScale+2, -m.depth*yScale-2)
+}
+
+// Render the part of a drawn map between two columns and two rows, inclusive, coloring the glyphs
+func renderText(text map[pair]rune, left, right, top, bottom int) []string {
 	var (
 		w     strings.Builder
 		lines []string
 	)
-	for y := m.depth*yScale + 2; y >= -m.depth*yScale-2; y-- {
-		for x := -m.depth*xScale - 3; x <= m.depth*xScale+3; x++ {
-			if ch, present := m.text[pair{x, y}]; present {
+	for y := top; y >= bottom; y-- {
+		for x := left; x <= right; x++ {
+			if ch, present := text[pair{x, y}]; present {
 				if ch == cross {
-					w.WriteString(ansiWrap(string(ch), ansiColors["red"]))
+					w.WriteString(ansiWrap(string(ch), colorMapYou))
 				} else if contain(len(unknownArrows), func(idx int) bool { return unknownArrows[idx] == ch }) {
-					w.WriteString(ansiWrap(string(ch), ansiColors["cyan"]))
+					w.WriteString(ansiWrap(string(ch), colorMapUnexplored))
 				} else if contain(len(outZoneArrows), func(idx int) bool { return outZoneArrows[idx] == ch }) {
-					w.WriteString(ansiWrap(string(ch), ansiColors["magenta"]))
+					w.WriteString(ansiWrap(string(ch), colorMapZone))
+				} else if contain(len(warpArrows), func(idx int) bool { return warpArrows[idx] == ch }) {
+					w.WriteString(ansiWrap(string(ch), colorMapElsewhere))
+				} else if ch == doorGlyphs[0] {
+					w.WriteString(ansiWrap(string(ch), colorMapDoor))
 				} else {
 					w.WriteRune(ch)
 				}
@@ -154,10 +180,6 @@ func (m *mapBuilder) drawBox(center pair) {
 			m.text[pair{x - 2 + xx, y + 1 - yy}] = elt
 		}
 	}
-
-	if center.x == 0 && center.y == 0 {
-		m.text[pair{x, y}] = cross
-	}
 }
 
 func (m *mapBuilder) drawExit(center pair, arrow rune, dir int) {
@@ -184,6 +206,29 @@ func (m *mapBuilder) drawExit(center pair, arrow rune, dir int) {
 	}
 }
 
+// Draw the line an exit runs along to a room further than the next place, where the layout was stretched
+func (m *mapBuilder) drawPassage(center pair, dir int, reach int) {
+	x, y := textCoords(center)
+	switch dir {
+	case 0:
+		for yy := y + 3; yy <= y+yScale*reach-3; yy++ {
+			m.text[pair{x, yy}] = '│'
+		}
+	case 1:
+		for xx := x + 4; xx <= x+xScale*reach-4; xx++ {
+			m.text[pair{xx, y}] = '─'
+		}
+	case 2:
+		for xx := x - 4; xx >= x-xScale*reach+4; xx-- {
+			m.text[pair{xx, y}] = '─'
+		}
+	default:
+		for yy := y - 3; yy >= y-yScale*reach+3; yy-- {
+			m.text[pair{x, yy}] = '│'
+		}
+	}
+}
+
 func textCoords(center pair) (int, int) {
 	return center.x * xScale, center.y * yScale
 }
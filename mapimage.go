@@ -0,0 +1,588 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	mapImageDir = "maps" // Where the mapimage command writes, in the directory the server runs in
+
+	// Sizes in pixels
+	cellWidth    = 190 // The space given to each room
+	cellHeight   = 100
+	roomWidth    = 130
+	roomHeight   = 44
+	stubLength   = 24 // Exits that don't reach a neighbouring room
+	panelTitle   = 40 // Above each level, for its name
+	legendHeight = 30
+	imageMargin  = 60 // Wide enough for the labels of exits on the edges
+	glyphWidth   = 6  // The advance of a character of mapFont, with a column of space
+	glyphHeight  = 8
+	noteLength   = 10 // The most characters of a zone name or room id written next to an exit
+)
+
+var (
+	imageInk       = color.RGBA{0x20, 0x20, 0x20, 0xff}
+	imagePaper     = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	imageVisited   = color.RGBA{0xc8, 0xe6, 0xc9, 0xff}
+	imageUnvisited = color.RGBA{0xe8, 0xe8, 0xe8, 0xff}
+	imageOtherZone = color.RGBA{0xb0, 0x30, 0xa0, 0xff}
+	imageElsewhere = color.RGBA{0x30, 0x90, 0x30, 0xff}
+	imageDoor      = color.RGBA{0xd0, 0x80, 0x00, 0xff}
+)
+
+type (
+	// Something a zone map can be drawn on
+	canvas interface {
+		line(x1, y1, x2, y2 int, c color.RGBA, dashed bool)
+		box(x, y, w, h int, fill, stroke color.RGBA)
+		// Text centered on a point, at a multiple of the size of mapFont
+		label(x, y int, text string, c color.RGBA, scale int)
+	}
+
+	svgCanvas struct {
+		w strings.Builder
+	}
+
+	pngCanvas struct {
+		img *image.RGBA
+	}
+
+	// A whole zone laid out for an image, each layer a panel under the last
+	zoneImage struct {
+		zone          *zone
+		l             *layout
+		visited       map[int]bool // The rooms to highlight, or nil for none
+		panels        []panel
+		width, height int
+	}
+
+	panel struct {
+		on         layer
+		top        int // Pixels from the top of the image
+		minX, maxX int // The rooms on it, in layout coordinates
+		minY, maxY int
+	}
+)
+
+// Lay out every room of a zone, starting from the lowest numbered room.
+// Rooms that can't be reached from it go on sheets of their own
+func newZoneImage(z *zone, visited map[int]bool) *zoneImage {
+	all := make(map[int]bool)
+	sorted := append([]*room{}, z.rooms...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+	for _, r := range sorted {
+		all[r.id] = true
+	}
+	img := &zoneImage{
+		zone:    z,
+		visited: visited,
+		l:       newZoneLayout(sorted[0], all),
+	}
+
+	top := imageMargin
+	for _, on := range img.l.layers() {
+		p := panel{on: on, top: top}
+		first := true
+		for _, r := range img.l.order {
+			at := img.l.places[r.id]
+			if at.layer() != on {
+				continue
+			}
+			if first {
+				p.minX, p.maxX, p.minY, p.maxY = at.x, at.x, at.y, at.y
+				first = false
+			}
+			p.minX, p.maxX = min(p.minX, at.x), max(p.maxX, at.x)
+			p.minY, p.maxY = min(p.minY, at.y), max(p.maxY, at.y)
+		}
+		img.panels = append(img.panels, p)
+		img.width = max(img.width, (p.maxX-p.minX+1)*cellWidth)
+		top += panelTitle + (p.maxY-p.minY+1)*cellHeight
+	}
+	img.width += 2 * imageMargin
+	img.height = top + legendHeight + imageMargin
+	return img
+}
+
+// The middle of a room's box, in pixels
+func (img *zoneImage) center(p panel, at place) (int, int) {
+	return imageMargin + (at.x-p.minX)*cellWidth + cellWidth/2, p.top + panelTitle + (p.maxY-at.y)*cellHeight + cellHeight/2
+}
+
+func (img *zoneImage) draw(c canvas) {
+	for _, p := range img.panels {
+		title := img.zone.name
+		if len(img.panels) > 1 {
+			title += ", " + p.on.String()
+		}
+		c.label(img.width/2, p.top+panelTitle/2, title, imageInk, 2)
+
+		for _, r := range img.l.order {
+			at := img.l.places[r.id]
+			if at.layer() != p.on {
+				continue
+			}
+			x, y := img.center(p, at)
+			fill := imagePaper
+			if img.visited != nil {
+				fill = imageUnvisited
+				if img.visited[r.id] {
+					fill = imageVisited
+				}
+			}
+			c.box(x-roomWidth/2, y-roomHeight/2, roomWidth, roomHeight, fill, imageInk)
+			c.label(x, y-7, shorten(r.name, (roomWidth-8)/glyphWidth), imageInk, 1)
+			c.label(x, y+8, fmt.Sprintf("#%d", r.id), imageInk, 1)
+			for dir := range r.exits {
+				img.drawExit(c, r, dir, x, y)
+			}
+		}
+	}
+	img.drawLegend(c)
+}
+
+// Draw an exit of the room whose box is centered on x, y
+func (img *zoneImage) drawExit(c canvas, r *room, dir int, x, y int) {
+	e := r.exits[dir]
+	target := e.to
+	if target == nil {
+		return
+	}
+	// Where the exit leaves the box and which way it goes. Up and down leave from the corners, like on the minimap
+	var fromX, fromY, dx, dy int
+	switch dir {
+	case 4:
+		fromX, fromY, dx, dy = x+roomWidth/2, y-roomHeight/2, 1, -1
+	case 5:
+		fromX, fromY, dx, dy = x-roomWidth/2, y+roomHeight/2, -1, 1
+	default:
+		// Pixels go down the image, rooms go north up it
+		dx, dy = dxByIndex[dir], -dyByIndex[dir]
+		fromX, fromY = x+dx*roomWidth/2, y+dy*roomHeight/2
+	}
+
+	ink, dashed, note := imageInk, false, ""
+	reach := img.l.reach(r, dir)
+	switch {
+	case target.zone != r.zone:
+		ink, note = imageOtherZone, target.zone.name
+	case reach == 0:
+		ink, dashed, note = imageElsewhere, true, fmt.Sprintf("#%d", target.id)
+	case dir < 4:
+		// A passage all the way to the next box. Two-way passages are drawn once, from the lower numbered room
+		back := target.exits[oppositeDirction[dir]].to == r
+		if back && target.id < r.id {
+			return
+		}
+		// Across any places left empty where the layout was stretched
+		toX, toY := fromX+dx*(reach*cellWidth-roomWidth), fromY+dy*(reach*cellHeight-roomHeight)
+		c.line(fromX, fromY, toX, toY, imageInk, false)
+		if !back {
+			arrowHead(c, fromX, fromY, toX, toY, imageInk)
+		}
+		drawDoor(c, e, (fromX+toX)/2, (fromY+toY)/2)
+		return
+	}
+
+	// Anything else is a short arrow, to the level above or below or labelled with where it goes
+	length := stubLength
+	if dir >= 4 {
+		length = stubLength * 2 / 3
+	}
+	toX, toY := fromX+dx*length, fromY+dy*length
+	c.line(fromX, fromY, toX, toY, ink, dashed)
+	arrowHead(c, fromX, fromY, toX, toY, ink)
+	drawDoor(c, e, (fromX+toX)/2, (fromY+toY)/2)
+	if note == "" {
+		return
+	}
+	note = shorten(note, noteLength)
+	if dx == 0 {
+		// Beside a north or south arrow
+		c.label(toX+len(note)*glyphWidth/2+4, (fromY+toY)/2, note, ink, 1)
+	} else {
+		// Above an east or west arrow, or beyond a corner one
+		c.label(toX+dx*len(note)*glyphWidth/2, toY-8, note, ink, 1)
+	}
+}
+
+// What the colors mean, along the bottom of the image
+func (img *zoneImage) drawLegend(c canvas) {
+	type entry struct {
+		color color.RGBA
+		text  string
+	}
+	entries := []entry{{imageOtherZone, "leads to another zone"}, {imageElsewhere, "leads elsewhere on the map"}, {imageDoor, "door"}}
+	if img.visited != nil {
+		entries = append(entries, entry{imageVisited, "visited"}, entry{imageUnvisited, "not visited"})
+	}
+	x, y := imageMargin, img.height-imageMargin-legendHeight/2
+	for _, e := range entries {
+		c.box(x, y-5, 10, 10, e.color, imageInk)
+		c.label(x+16+len(e.text)*glyphWidth/2, y, e.text, imageInk, 1)
+		x += 16 + len(e.text)*glyphWidth + 20
+	}
+}
+
+// Draw the two sides of an arrow's point at its end
+func arrowHead(c canvas, x1, y1, x2, y2 int, ink color.RGBA) {
+	angle := math.Atan2(float64(y2-y1), float64(x2-x1))
+	for _, side := range []float64{-0.5, 0.5} {
+		back := angle + math.Pi + side
+		c.line(x2, y2, x2+int(math.Round(8*math.Cos(back))), y2+int(math.Round(8*math.Sin(back))), ink, false)
+	}
+}
+
+// Mark the door of an exit, if it has one
+func drawDoor(c canvas, e exit, x, y int) {
+	if e.door != nil {
+		c.box(x-3, y-3, 7, 7, imageDoor, imageDoor)
+	}
+}
+
+// Cut text down to a number of characters, showing that it was cut
+func shorten(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-1]) + "~"
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func newSVGCanvas(width, height int) *svgCanvas {
+	c := &svgCanvas{}
+	fmt.Fprintf(&c.w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"monospace\">\n", width, height, width, height)
+	fmt.Fprintf(&c.w, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hexColor(imagePaper))
+	return c
+}
+
+func (c *svgCanvas) line(x1, y1, x2, y2 int, ink color.RGBA, dashed bool) {
+	dash := ""
+	if dashed {
+		dash = " stroke-dasharray=\"4 3\""
+	}
+	fmt.Fprintf(&c.w, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\"%s/>\n", x1, y1, x2, y2, hexColor(ink), dash)
+}
+
+func (c *svgCanvas) box(x, y, w, h int, fill, stroke color.RGBA) {
+	fmt.Fprintf(&c.w, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"%s\"/>\n", x, y, w, h, hexColor(fill), hexColor(stroke))
+}
+
+func (c *svgCanvas) label(x, y int, text string, ink color.RGBA, scale int) {
+	fmt.Fprintf(&c.w, "<text x=\"%d\" y=\"%d\" font-size=\"%d\" fill=\"%s\" text-anchor=\"middle\" dominant-baseline=\"central\">%s</text>\n",
+		x, y, 10*scale, hexColor(ink), html.EscapeString(text))
+}
+
+func (c *svgCanvas) bytes() []byte {
+	return []byte(c.w.String() + "</svg>\n")
+}
+
+func newPNGCanvas(width, height int) *pngCanvas {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{imagePaper}, image.Point{}, draw.Src)
+	return &pngCanvas{img: img}
+}
+
+// Bresenham's line, leaving gaps if dashed
+func (c *pngCanvas) line(x1, y1, x2, y2 int, ink color.RGBA, dashed bool) {
+	dx, sx := x2-x1, 1
+	if dx < 0 {
+		dx, sx = -dx, -1
+	}
+	dy, sy := y1-y2, 1
+	if dy > 0 {
+		dy, sy = -dy, -1
+	}
+	err := dx + dy
+	for i := 0; ; i++ {
+		if !dashed || i%7 < 4 {
+			c.img.SetRGBA(x1, y1, ink)
+		}
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x1 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y1 += sy
+		}
+	}
+}
+
+func (c *pngCanvas) box(x, y, w, h int, fill, stroke color.RGBA) {
+	draw.Draw(c.img, image.Rect(x, y, x+w, y+h), &image.Uniform{fill}, image.Point{}, draw.Src)
+	c.line(x, y, x+w-1, y, stroke, false)
+	c.line(x, y+h-1, x+w-1, y+h-1, stroke, false)
+	c.line(x, y, x, y+h-1, stroke, false)
+	c.line(x+w-1, y, x+w-1, y+h-1, stroke, false)
+}
+
+func (c *pngCanvas) label(x, y int, text string, ink color.RGBA, scale int) {
+	runes := []rune(text)
+	left, top := x-(len(runes)*glyphWidth-1)*scale/2, y-glyphHeight*scale/2
+	for i, ch := range runes {
+		if ch < ' ' || ch > '~' {
+			ch = '?'
+		}
+		for col, bits := range mapFont[ch-' '] {
+			for row := 0; row < glyphHeight; row++ {
+				if bits&(1<<row) == 0 {
+					continue
+				}
+				px, py := left+(i*glyphWidth+col)*scale, top+row*scale
+				draw.Draw(c.img, image.Rect(px, py, px+scale, py+scale), &image.Uniform{ink}, image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+// Draw a zone to a file, as SVG or PNG depending on its extension
+func writeZoneImage(path string, z *zone, visited map[int]bool) error {
+	if len(z.rooms) == 0 {
+		return fmt.Errorf("zone %d has no rooms", z.id)
+	}
+	img := newZoneImage(z, visited)
+	var data []byte
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".svg":
+		c := newSVGCanvas(img.width, img.height)
+		img.draw(c)
+		data = c.bytes()
+	case ".png":
+		c := newPNGCanvas(img.width, img.height)
+		img.draw(c)
+		var b bytes.Buffer
+		if err := png.Encode(&b, c.img); err != nil {
+			return fmt.Errorf("encoding png: %v", err)
+		}
+		data = b.Bytes()
+	default:
+		return fmt.Errorf("unknown image format '%s', use .svg or .png", ext)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// The 'map-image' subcommand: draw a zone as an image
+func runMapImage(args []string) int {
+	flags := flag.NewFlagSet("mud map-image", flag.ContinueOnError)
+	path := flags.String("db", cfg.Database, "path to the world database")
+	zoneID := flags.Int("zone", 0, "id of the zone to draw")
+	name := flags.String("player", "", "highlight the rooms this player has visited")
+	out := flags.String("o", "", "file to write, ending in .svg or .png (default <zone id>.svg)")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if *zoneID == 0 {
+		fmt.Fprintln(os.Stderr, "usage: mud map-image -zone <id> [-player name] [-o file.svg|file.png]")
+		return 2
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("%d.svg", *zoneID)
+	}
+	createMaps()
+
+	if _, err := os.Stat(*path); err != nil {
+		fmt.Fprintf(os.Stderr, "opening database: %v\n", err)
+		return 1
+	}
+	var err error
+	db, err = sql.Open("sqlite3", *path+"?_busy_timeout=10000&mode=ro")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opening database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	var visited map[int]bool
+	err = readTransaction(func(tx *sql.Tx) error {
+		for _, read := range []func(*sql.Tx) error{readZones, readRooms, readExits} {
+			if err := read(tx); err != nil {
+				return err
+			}
+		}
+		if *name == "" {
+			return nil
+		}
+		visited = make(map[int]bool)
+		return readVisited(tx, *name, visited)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reading world: %v\n", err)
+		return 1
+	}
+	z, exists := zones[*zoneID]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "There is no zone %d\n", *zoneID)
+		return 1
+	}
+	if err := writeZoneImage(*out, z, visited); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Drew %s (%d %s) to %s\n", z.name, len(z.rooms), plural(len(z.rooms), "room"), *out)
+	return 0
+}
+
+// Administration
+
+// Draw a zone to an image file on the server, highlighting where a player has been
+func (p *player) doMapImage(cmd string) {
+	z, format, name := p.zone, "svg", ""
+	for _, word := range strings.Fields(cmd) {
+		if id, err := strconv.Atoi(word); err == nil {
+			if z = zones[id]; z == nil {
+				p.send(event{
+					player: p,
+					output: fmt.Sprintf("There is no zone %d.", id),
+					err:    true,
+				})
+				return
+			}
+		} else if w := strings.ToLower(word); w == "svg" || w == "png" {
+			format = w
+		} else {
+			name = word
+		}
+	}
+	if len(z.rooms) == 0 {
+		p.send(event{
+			player: p,
+			output: "That zone has no rooms to draw.",
+			err:    true,
+		})
+		return
+	}
+
+	var visited map[int]bool
+	if name != "" {
+		a, err := findAccount(name)
+		if err == sql.ErrNoRows {
+			p.send(event{
+				player: p,
+				output: "No such player!",
+				err:    true,
+			})
+			return
+		}
+		if err == nil {
+			if other, online := players[a.name]; online {
+				visited = other.visited
+			} else {
+				visited = make(map[int]bool)
+				err = readTransaction(func(tx *sql.Tx) error { return readVisited(tx, a.name, visited) })
+			}
+		}
+		if err != nil {
+			serverLog.Printf("reading rooms visited by '%s': %v", name, err)
+			p.send(event{
+				player: p,
+				output: "Something went wrong, no map was drawn.",
+				err:    true,
+			})
+			return
+		}
+	}
+
+	// Drawing big zones takes a while, so it happens on a copy away from the main goroutine
+	snapshot := snapshotZone(z)
+	if visited != nil {
+		visited = copyVisited(visited)
+	}
+	path := filepath.Join(mapImageDir, fmt.Sprintf("%d.%s", z.id, format))
+	go func() {
+		err := os.MkdirAll(mapImageDir, 0755)
+		if err == nil {
+			err = writeZoneImage(path, snapshot, visited)
+		}
+		// The player has likely moved on, so these arrive like any other news
+		finished <- func() {
+			if err != nil {
+				serverLog.Printf("drawing zone %d: %v", snapshot.id, err)
+				p.send(event{
+					output: "Something went wrong, no map was drawn.",
+					err:    true,
+				})
+				return
+			}
+			p.send(event{
+				output: fmt.Sprintf("Drew %s to %s on the server.", snapshot.name, path),
+			})
+		}
+	}()
+}
+
+// Copy a zone's rooms and exits, so it can be drawn while the world goes on.
+// Rooms in other zones that exits lead to are copied without their own exits
+func snapshotZone(z *zone) *zone {
+	zoneCopies := make(map[*zone]*zone)
+	roomCopies := make(map[*room]*room)
+	copyZone := func(z *zone) *zone {
+		if c, exists := zoneCopies[z]; exists {
+			return c
+		}
+		c := &zone{id: z.id, name: z.name}
+		zoneCopies[z] = c
+		return c
+	}
+	copyRoom := func(r *room) *room {
+		if c, exists := roomCopies[r]; exists {
+			return c
+		}
+		c := &room{id: r.id, zone: copyZone(r.zone), name: r.name}
+		roomCopies[r] = c
+		return c
+	}
+
+	snapshot := copyZone(z)
+	for _, r := range z.rooms {
+		c := copyRoom(r)
+		for dir, e := range r.exits {
+			if e.to != nil {
+				e.to = copyRoom(e.to)
+			}
+			if e.door != nil {
+				d := *e.door
+				e.door = &d
+			}
+			c.exits[dir] = e
+		}
+		snapshot.rooms = append(snapshot.rooms, c)
+	}
+	return snapshot
+}
+
+func copyVisited(visited map[int]bool) map[int]bool {
+	c := make(map[int]bool, len(visited))
+	for id := range visited {
+		c[id] = true
+	}
+	return c
+}
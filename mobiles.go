@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	wanderInterval = 15 * time.Second // How often mobiles get a chance to move
+)
+
+// Whether a word refers to this mobile, by prefix of any keyword
+func (m *mob) matches(word string) bool {
+	word = strings.ToLower(word)
+	return contain(len(m.mobile.keywords), func(idx int) bool { return strings.HasPrefix(m.mobile.keywords[idx], word) })
+}
+
+// Find the first mobile in the room a word refers to, or nil
+func (r *room) findMob(word string) *mob {
+	if i := index(len(r.mobs), func(idx int) bool { return r.mobs[idx].matches(word) }); i != -1 {
+		return r.mobs[i]
+	}
+	return nil
+}
+
+// Remove a mobile from the room
+func (r *room) removeMob(m *mob) {
+	if i := index(len(r.mobs), func(idx int) bool { return r.mobs[idx] == m }); i != -1 {
+		r.mobs = append(r.mobs[:i], r.mobs[i+1:]...)
+	}
+}
+
+// Show a message to every player in the room
+func (r *room) announce(cmd *command, msg string) {
+	for _, p := range r.players {
+		p.send(event{
+			output:  msg,
+			command: cmd,
+		})
+	}
+}
+
+// Move through an exit, letting both rooms know
+func (m *mob) move(dir int) {
+	to := m.room.exits[dir].to
+	m.room.announce(nil, fmt.Sprintf("%s leaves %s.", capitalize(m.mobile.name), dirs[string(dirIntToRune[dir])]))
+	m.room.removeMob(m)
+	m.room = to
+	to.mobs = append(to.mobs, m)
+	m.room.announce(nil, fmt.Sprintf("%s has arrived.", capitalize(m.mobile.name)))
+}
+
+// Give every wandering mobile a chance to take a random exit
+func wanderMobs() {
+	for _, m := range mobs {
+		if m.mobile.wander <= 0 || rand.Intn(100) >= m.mobile.wander {
+			continue
+		}
+		// Mobiles in a fight stay until it is over
+		if m.opponent() != nil {
+			continue
+		}
+		choices := []int{}
+		for dir, exit := range m.room.exits {
+			if exit.to == nil || exit.blocked() || (m.mobile.stayZone && exit.to.zone != m.room.zone) {
+				continue
+			}
+			choices = append(choices, dir)
+		}
+		if len(choices) > 0 {
+			m.move(choices[rand.Intn(len(choices))])
+		}
+	}
+}
+
+// Let mobiles in the room answer anything said that contains one of their keywords
+func (r *room) hearSay(speaker *player, msg string) {
+	words := strings.FieldsFunc(strings.ToLower(msg), func(ch rune) bool {
+		return !('a' <= ch && ch <= 'z')
+	})
+	for _, m := range r.mobs {
+		for _, word := range words {
+			if reply, exists := m.mobile.sayings[word]; exists {
+				m.room.announce(commands["say"], fmt.Sprintf("%s says: %s", capitalize(m.mobile.name), ansiWrap(m.respond(reply, speaker), colorChannel)))
+				break
+			}
+		}
+	}
+}
+
+// React to an emote aimed at the mobile, if it has anything to say about it
+func (m *mob) react(cmd *command, actor *player) {
+	if reply, exists := m.mobile.reactions[cmd.name]; exists {
+		m.room.announce(cmd, m.respond(reply, actor))
+	}
+}
+
+// Fill in a scripted response. $n is replaced with the player's name
+func (m *mob) respond(reply string, actor *player) string {
+	return strings.ReplaceAll(reply, "$n", actor.name)
+}
+
+// Upper case the first letter, for names starting a sentence
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
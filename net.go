@@ -6,104 +6,112 @@ import (
 	"log"
 	"math"
 	"net"
-	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	outputQueueSize = 256              // Events a player can fall behind before being dropped
+	writeTimeout    = 10 * time.Second // How long a client may stall a single write
+)
+
+var (
+	writers sync.WaitGroup // Tracks listenMUD goroutines so shutdown can wait for final output
+)
+
 // Listen for incoming client connections
 func listenConnections(inputs chan input) {
-	server, err := net.Listen("tcp", ":"+port)
+	server, err := net.Listen("tcp", cfg.Listen)
 	if err != nil {
-		serverLog.Fatalf("Error starting server on port %s: %v", port, err)
+		serverLog.Fatalf("Error starting server on %s: %v", cfg.Listen, err)
 	}
 	defer server.Close()
-	serverLog.Printf("Listening for connections on %s:%s\n", serverAddress, port)
+	serverLog.Printf("Listening for connections on %s (local address %s)\n", cfg.Listen, serverAddress)
 	for {
 		conn, err := server.Accept()
 		if err != nil {
 			serverLog.Fatalf("Error accepting connection: %v", err)
 		}
-		go handleConnection(conn, inputs)
+		go handleConnection(newTelnetConn(conn), inputs)
 	}
 }
 
 // Handle a client connection with their own command loop
-func handleConnection(conn net.Conn, inputs chan input) {
+func handleConnection(conn *telnetConn, inputs chan input) {
 	clientLog := log.New(conn, "CLIENT: ", log.Ldate|log.Ltime)
 	fmt.Fprintln(conn)
-	clientLog.Printf("Connected to MUD server on %s:%s\n\n", serverAddress, port)
+	clientLog.Printf("Connected to MUD server on %s\n\n", conn.LocalAddr().String())
 
 	// Log connection to server
 	serverLog.Printf("Client connected from %s", conn.RemoteAddr().String())
 
 	scanner := bufio.NewScanner(conn)
 
-	// Validate username loop
-	var (
-		p   *player
-		err error
-	)
-	for badName := true; badName; badName = (err != nil) {
-		if err != nil {
-			fmt.Fprintln(conn, err)
-		}
-		fmt.Fprint(conn, "Please enter your name: ")
-		scanner.Scan()
-		name := scanner.Text()
-		if len(strings.Fields(name)) > 1 {
-			err = fmt.Errorf("Username must be one word")
-			continue
-		}
-		if len(name) > 20 {
-			err = fmt.Errorf("Username must be less than 21 characters")
-			continue
-		}
-		p, err = createPlayer(name, conn, clientLog)
+	if cfg.LoginTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(time.Duration(cfg.LoginTimeout)))
 	}
-
-	// Player object is initialized
-	go p.listenMUD()
-
-	p.joinServer()
-
-	fmt.Fprintf(p.conn, "\nHello, %s! Welcome to MUD!\n\n\n", p.name)
-
-	serverLog.Printf("player '%s' joined the MUD from %s", p.name, conn.RemoteAddr().String())
-
-	// Add delay to show welcome msg before entering prompt
-	time.Sleep(1000 * time.Millisecond)
-
-	fmt.Fprint(p.conn, "\x1b[2J")
-
-	p.printLocation()
-
-	p.events <- event{
-		player:      nil,
-		output:      "Type 'help' to see all available commands!",
-		unsolicited: true,
+	p, err := login(conn, scanner, clientLog, inputs)
+	if err != nil {
+		serverLog.Printf("Client %s left before logging in", conn.RemoteAddr().String())
+		conn.Close()
+		return
 	}
+	conn.SetReadDeadline(time.Time{})
 
-	for scanner.Scan() {
+	p.readInputs(scanner, inputs)
+}
+
+// Forward lines from the client to the world until the connection closes
+func (p *player) readInputs(scanner *bufio.Scanner, inputs chan input) {
+	for {
+		if cfg.IdleTimeout > 0 {
+			p.conn.SetReadDeadline(time.Now().Add(time.Duration(cfg.IdleTimeout)))
+		}
+		if !scanner.Scan() {
+			break
+		}
 		// Send raw input as command to be parsed
-		inputs <- input{p, scanner.Text(), false}
+		inputs <- input{player: p, text: scanner.Text()}
 	}
+	// Connection has been closed, pass along any error to be logged
+	closed := input{player: p, end: true}
 	if err := scanner.Err(); err != nil {
-		if p.events != nil {
-			serverLog.Printf("Client %s connection error: %v", conn.RemoteAddr().String(), err)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			closed.idle = true
+		} else {
+			closed.text = err.Error()
 		}
-		// Ignore
 	}
-	// Connection has been closed
-	inputs <- input{p, "", true}
+	inputs <- closed
 }
 
-// Have a client listen for mud events
+// Have a client listen for mud events.
+// This goroutine only writes to the connection; anything it draws from the world arrives in the event
 func (p *player) listenMUD() {
-	defer p.conn.Close()
+	defer writers.Done()
+	p.out = bufio.NewWriter(p.conn)
+
+	if p.screen.plain {
+		fmt.Fprintf(p.out, "\r\nHello, %s! Welcome to MUD!\r\n\r\n", p.name)
+	} else {
+		fmt.Fprintf(p.out, "\nHello, %s! Welcome to MUD!\n\n\n", p.name)
+		p.flush()
+		// Add delay to show welcome msg before entering prompt
+		time.Sleep(1000 * time.Millisecond)
+		fmt.Fprint(p.out, "\x1b[2J")
+	}
+
+	// Once a write fails the rest of the queue is discarded until the world notices the dead connection
+	alive := true
 	for ev := range p.events {
-		if ev.updateMap {
-			p.visited[p.room.id] = true
-			p.minimap.trace(p.room, p.visited)
+		if !alive {
+			continue
+		}
+		if ev.minimap != nil {
+			p.view = *ev.minimap
+		}
+		if ev.display != nil {
+			p.screen = *ev.display
 		}
 		if ev.player != p {
 			ev.unsolicited = true
@@ -112,48 +120,114 @@ func (p *player) listenMUD() {
 			// Color output based on command effect
 			switch ev.command.category {
 			case emotes:
-				ev.output = ansiWrap(ev.output, ansiColors["white"])
+				ev.output = ansiWrap(ev.output, colorEmote)
 			case nav:
-				ev.output = ansiWrap(ev.output, ansiColors["cyan"])
+				ev.output = ansiWrap(ev.output, colorNav)
 			}
 		}
 		if ev.err {
-			ev.output = ansiWrap(ev.output, ansiColors["red"])
+			ev.output = ansiWrap(ev.output, colorError)
 		}
-		p.eventPrint(ev)
-		time.Sleep(time.Duration(ev.delay) * time.Millisecond)
+		ev.output = p.screen.paint(ev.output)
+		if p.screen.plain {
+			p.plainPrint(ev)
+		} else {
+			p.eventPrint(ev)
+		}
+		if alive = p.flush(); alive {
+			time.Sleep(time.Duration(ev.delay) * time.Millisecond)
+		}
+	}
+	if p.rebooting {
+		// The connection is handed over to the next server process as is
+		return
 	}
-	// Clear screen
-	fmt.Fprint(p.conn, "\x1b[2J")
-	fmt.Fprintf(p.conn, "Goodbye %s!\nThanks for playing!\n", p.name)
-	p.log.Printf("Disconnected from MUD server on %s:%s\n", serverAddress, port)
+	defer p.conn.Close()
+	if !alive {
+		serverLog.Printf("player '%s' connection terminated\n", p.name)
+		return
+	}
+	if p.screen.plain {
+		fmt.Fprintf(p.out, "\r\nGoodbye %s!\r\nThanks for playing!\r\n", p.name)
+	} else {
+		// Clear screen
+		fmt.Fprint(p.out, "\x1b[2J")
+		fmt.Fprintf(p.out, "Goodbye %s!\nThanks for playing!\n", p.name)
+	}
+	p.flush()
+	p.log.Printf("Disconnected from MUD server on %s\n", p.conn.LocalAddr().String())
 	playTime := time.Now().Sub(p.beginTime)
 	h, m := int(math.Round(playTime.Hours())), int(math.Round(playTime.Minutes()))%60
-	p.log.Printf("You played for %s %s and %s %s", ansiWrap(fmt.Sprint(h), ansiColors["green"]), plural(h, "hour"), ansiWrap(fmt.Sprint(m), ansiColors["green"]), plural(m, "minute"))
+	p.log.Print(p.screen.paint(fmt.Sprintf("You played for %s %s and %s %s", ansiWrap(fmt.Sprint(h), colorValue), plural(h, "hour"), ansiWrap(fmt.Sprint(m), colorValue), plural(m, "minute"))))
+	total := p.playTime + playTime
+	h, m = int(total.Hours()), int(total.Minutes())%60
+	p.log.Print(p.screen.paint(fmt.Sprintf("Total time played: %s %s and %s %s", ansiWrap(fmt.Sprint(h), colorValue), plural(h, "hour"), ansiWrap(fmt.Sprint(m), colorValue), plural(m, "minute"))))
 
 	serverLog.Printf("player '%s' connection terminated\n", p.name)
 }
 
+// Write out buffered output, giving up on clients that stop reading.
+// Returns false if the connection is no longer usable
+func (p *player) flush() bool {
+	p.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := p.out.Flush(); err != nil {
+		serverLog.Printf("player '%s' write failed: %v", p.name, err)
+		// Closing makes the reading goroutine report the disconnect
+		p.conn.Close()
+		return false
+	}
+	return true
+}
+
+// Queue an event for the player without ever blocking the world.
+// A player whose queue is full is treated as link-dead and disconnected
+func (p *player) send(ev event) {
+	if p.events == nil || p.linkDead {
+		return
+	}
+	select {
+	case p.events <- ev:
+	default:
+		p.linkDead = true
+		serverLog.Printf("player '%s' output queue is full, dropping link", p.name)
+		// The disconnect itself happens when the reading goroutine notices the closed connection
+		p.conn.Close()
+	}
+}
+
 // Terminate a connection and remove the player from the world data
 func (p *player) disconnect() {
 	// Notify players in room
 	for _, other := range p.room.players {
 		if other != p {
-			other.events <- event{
+			other.send(event{
 				player: p,
 				output: fmt.Sprintf("%s has left the room", p.name),
-			}
+			})
 		}
 	}
 	// Notify players on server of player leaving
 	for _, other := range players {
 		if other != p {
-			other.events <- event{
+			other.send(event{
 				player: p,
 				output: fmt.Sprintf("%s has left the server", p.name),
-			}
+			})
 		}
 	}
+	p.leaveWorld()
+	// Log to server
+	serverLog.Printf("player '%s' disconnected from %s\n", p.name, p.conn.RemoteAddr().String())
+}
+
+// Save the player and remove them from the world without notifying anyone.
+// The connection closes once listenMUD has drained the event channel
+func (p *player) leaveWorld() {
+	stopFighting(p)
+	p.stopTravel("")
+	if err := p.save(); err != nil {
+		serverLog.Printf("saving player '%s': %v", p.name, err)
+	}
 	// Shut down channel
 	close(p.events)
 	p.events = nil
@@ -161,7 +235,4 @@ func (p *player) disconnect() {
 	p.room.removePlayer(p)
 	p.zone.removePlayer(p)
 	delete(players, p.name)
-	// Log to server
-	serverLog.Printf("player '%s' disconnected from %s\n", p.name, p.conn.RemoteAddr().String())
-	// Connection will automatically close after channel is closed
 }
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Redraw every player's minimap after the world has changed shape
+func refreshMinimaps() {
+	for _, p := range players {
+		p.send(event{
+			minimap: p.minimap.snapshot(p.room, p.visited),
+		})
+	}
+}
+
+// Report a failed write to the builder and the server log
+func (p *player) buildFailed(err error) {
+	serverLog.Printf("player '%s' building: %v", p.name, err)
+	p.send(event{
+		player: p,
+		output: "Something went wrong, nothing was changed.",
+		err:    true,
+	})
+}
+
+// Show a room that was just renamed or described to everyone in it
+func (r *room) showChange(builder *player) {
+	for _, other := range r.players {
+		if other == builder {
+			builder.printLocation()
+			continue
+		}
+		other.send(event{
+			output: ansiWrap(fmt.Sprintf("%s reshapes the room around you.", builder.name), colorNotice) + "\n\n" + other.describeLocation(),
+		})
+	}
+}
+
+// Add a room to the live world
+func addRoom(id int, z *zone, name string, desc string) *room {
+	r := &room{
+		id:          id,
+		zone:        z,
+		name:        name,
+		description: desc,
+		players:     []*player{},
+	}
+	rooms[id] = r
+	z.rooms = append(z.rooms, r)
+	return r
+}
+
+// Building
+
+// Create, rename or describe rooms
+func (p *player) doRoom(cmd string) {
+	usage := "Usage: room create [zone <id>] <name> | room rename <name> | room describe <text>"
+	words := strings.Fields(cmd)
+	if len(words) < 2 {
+		p.send(event{
+			player: p,
+			output: usage,
+			err:    true,
+		})
+		return
+	}
+	text := strings.TrimSpace(strings.TrimPrefix(cmd, words[0]))
+	switch strings.ToLower(words[0]) {
+	case "create":
+		z := p.zone
+		// The zone has its own keyword, so names can end in numbers
+		if len(words) > 2 && strings.ToLower(words[1]) == "zone" {
+			id, err := strconv.Atoi(words[2])
+			if err != nil || len(words) < 4 {
+				p.send(event{
+					player: p,
+					output: usage,
+					err:    true,
+				})
+				return
+			}
+			if z = zones[id]; z == nil {
+				p.send(event{
+					player: p,
+					output: fmt.Sprintf("There is no zone %d.", id),
+					err:    true,
+				})
+				return
+			}
+			text = strings.Join(words[3:], " ")
+		}
+		var id int
+		err := writeTransaction(func(tx *sql.Tx) (err error) {
+			id, err = insertRoom(tx, z.id, text, "")
+			return err
+		})
+		if err != nil {
+			p.buildFailed(err)
+			return
+		}
+		addRoom(id, z, text, "")
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("Created room %d, %s, in %s. Use 'link' to connect it.", id, text, z.name),
+		})
+	case "rename":
+		if err := writeTransaction(func(tx *sql.Tx) error { return updateRoom(tx, p.room.id, text, p.room.description) }); err != nil {
+			p.buildFailed(err)
+			return
+		}
+		p.room.name = text
+		p.room.showChange(p)
+	case "describe":
+		// Descriptions end in a newline, like the ones the world came with
+		text += "\n"
+		if err := writeTransaction(func(tx *sql.Tx) error { return updateRoom(tx, p.room.id, p.room.name, text) }); err != nil {
+			p.buildFailed(err)
+			return
+		}
+		p.room.description = text
+		p.room.showChange(p)
+	default:
+		p.send(event{
+			player: p,
+			output: usage,
+			err:    true,
+		})
+	}
+}
+
+// Create zones
+func (p *player) doZone(cmd string) {
+	words := strings.Fields(cmd)
+	if len(words) < 2 || strings.ToLower(words[0]) != "create" {
+		p.send(event{
+			player: p,
+			output: "Usage: zone create <name>",
+			err:    true,
+		})
+		return
+	}
+	name := strings.Join(words[1:], " ")
+	var id int
+	err := writeTransaction(func(tx *sql.Tx) (err error) {
+		id, err = insertZone(tx, name)
+		return err
+	})
+	if err != nil {
+		p.buildFailed(err)
+		return
+	}
+	zones[id] = &zone{
+		id:      id,
+		name:    name,
+		rooms:   []*room{},
+		players: []*player{},
+	}
+	p.send(event{
+		player: p,
+		output: fmt.Sprintf("Created zone %d, %s. Use 'room create zone %d <name>' to give it rooms.", id, name, id),
+	})
+}
+
+// Make a new room in a direction, joined both ways to this one
+func (p *player) doDig(cmd string) {
+	words := strings.Fields(cmd)
+	dir := -1
+	if len(words) > 1 {
+		dir = parseDirection(words[0])
+	}
+	if dir == -1 {
+		p.send(event{
+			player: p,
+			output: "Usage: dig <direction> <room name>",
+			err:    true,
+		})
+		return
+	}
+	if p.room.exits[dir].to != nil {
+		p.send(event{
+			player: p,
+			output: "There is already an exit that way.",
+			err:    true,
+		})
+		return
+	}
+	name := strings.Join(words[1:], " ")
+	back := oppositeDirction[dir]
+	var id int
+	err := writeTransaction(func(tx *sql.Tx) (err error) {
+		if id, err = insertRoom(tx, p.zone.id, name, ""); err != nil {
+			return err
+		}
+		if err := insertExit(tx, p.room.id, dir, id, fmt.Sprintf("You see %s.", name)); err != nil {
+			return err
+		}
+		return insertExit(tx, id, back, p.room.id, fmt.Sprintf("You see %s.", p.room.name))
+	})
+	if err != nil {
+		p.buildFailed(err)
+		return
+	}
+	r := addRoom(id, p.zone, name, "")
+	p.room.exits[dir] = exit{to: r, description: fmt.Sprintf("You see %s.", name)}
+	r.exits[back] = exit{to: p.room, description: fmt.Sprintf("You see %s.", p.room.name)}
+	p.send(event{
+		player: p,
+		output: fmt.Sprintf("Dug %s to room %d, %s.", dirs[string(dirIntToRune[dir])], id, name),
+	})
+	refreshMinimaps()
+}
+
+// Connect an exit to an existing room, and back again if that side is free
+func (p *player) doLink(cmd string) {
+	words := strings.Fields(cmd)
+	dir, id := -1, 0
+	if len(words) == 2 {
+		dir = parseDirection(words[0])
+		id, _ = strconv.Atoi(words[1])
+	}
+	if dir == -1 || id == 0 {
+		p.send(event{
+			player: p,
+			output: "Usage: link <direction> <room id>",
+			err:    true,
+		})
+		return
+	}
+	target, exists := rooms[id]
+	switch {
+	case !exists:
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("There is no room %d.", id),
+			err:    true,
+		})
+		return
+	case target == p.room:
+		p.send(event{
+			player: p,
+			output: "A room can't lead to itself.",
+			err:    true,
+		})
+		return
+	case p.room.exits[dir].to != nil:
+		p.send(event{
+			player: p,
+			output: "There is already an exit that way.",
+			err:    true,
+		})
+		return
+	}
+	back := oppositeDirction[dir]
+	twoWay := target.exits[back].to == nil
+	err := writeTransaction(func(tx *sql.Tx) error {
+		if err := insertExit(tx, p.room.id, dir, target.id, fmt.Sprintf("You see %s.", target.name)); err != nil {
+			return err
+		}
+		if twoWay {
+			return insertExit(tx, target.id, back, p.room.id, fmt.Sprintf("You see %s.", p.room.name))
+		}
+		return nil
+	})
+	if err != nil {
+		p.buildFailed(err)
+		return
+	}
+	p.room.exits[dir] = exit{to: target, description: fmt.Sprintf("You see %s.", target.name)}
+	output := fmt.Sprintf("Linked %s to room %d, %s.", dirs[string(dirIntToRune[dir])], target.id, target.name)
+	if twoWay {
+		target.exits[back] = exit{to: p.room, description: fmt.Sprintf("You see %s.", p.room.name)}
+	} else {
+		output += " The way back was already taken, so the exit is one-way."
+	}
+	p.send(event{
+		player: p,
+		output: output,
+	})
+	refreshMinimaps()
+}
+
+// Remove an exit, and the way back if it leads here
+func (p *player) doUnlink(cmd string) {
+	words := strings.Fields(cmd)
+	dir := -1
+	if len(words) == 1 {
+		dir = parseDirection(words[0])
+	}
+	if dir == -1 {
+		p.send(event{
+			player: p,
+			output: "Usage: unlink <direction>",
+			err:    true,
+		})
+		return
+	}
+	target := p.room.exits[dir].to
+	if target == nil {
+		p.send(event{
+			player: p,
+			output: "There is no exit that way.",
+			err:    true,
+		})
+		return
+	}
+	back := oppositeDirction[dir]
+	twoWay := target.exits[back].to == p.room
+	err := writeTransaction(func(tx *sql.Tx) error {
+		if err := deleteExit(tx, p.room.id, dir); err != nil {
+			return err
+		}
+		if twoWay {
+			return deleteExit(tx, target.id, back)
+		}
+		return nil
+	})
+	if err != nil {
+		p.buildFailed(err)
+		return
+	}
+	p.room.exits[dir] = exit{}
+	if twoWay {
+		target.exits[back] = exit{}
+	}
+	p.send(event{
+		player: p,
+		output: fmt.Sprintf("Removed the exit %s to room %d.", dirs[string(dirIntToRune[dir])], target.id),
+	})
+	refreshMinimaps()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A per-player setting that is saved with the character
+type preference struct {
+	name        string
+	description string
+	usage       string                      // The accepted values
+	fallback    string                      // The value used when unset
+	apply       func(*player, string) error // Validates and applies a new value
+}
+
+var (
+	preferences map[string]*preference // All known preferences by name
+)
+
+// Adds all known preferences
+func defaultPreferences() {
+	preferences = make(map[string]*preference)
+
+	addPreference(preference{
+		name:        "minimap",
+		description: "How many rooms the minimap shows in each direction",
+		usage:       "1-6",
+		fallback:    strconv.Itoa(cfg.MapDepth),
+		apply:       (*player).applyMinimap,
+	})
+	addPreference(preference{
+		name:        "mapzoom",
+		description: "How closely the map command draws zones",
+		usage:       "1-2",
+		fallback:    strconv.Itoa(zoomFull),
+		apply:       (*player).applyMapZoom,
+	})
+	addPreference(preference{
+		name:        "display",
+		description: "The full screen with a minimap, or plain lines of text",
+		usage:       "auto, full or plain",
+		fallback:    "auto",
+		apply:       (*player).applyDisplay,
+	})
+	addPreference(preference{
+		name:        "color",
+		description: "Whether output is colored",
+		usage:       "on or off",
+		fallback:    "on",
+		apply:       (*player).applyColor,
+	})
+	addPreference(preference{
+		name:        "theme",
+		description: "The colors for each kind of output, see 'color'",
+		usage:       strings.Join(themeNames(), ", "),
+		fallback:    "default",
+		apply:       (*player).applyTheme,
+	})
+}
+
+func addPreference(pref preference) {
+	preferences[pref.name] = &pref
+}
+
+// The current value of a preference
+func (p *player) preference(name string) string {
+	if value, exists := p.prefs[name]; exists {
+		return value
+	}
+	return preferences[name].fallback
+}
+
+// Apply all preferences after loading a player.
+// Saved values that are no longer valid are dropped
+func (p *player) applyPreferences() {
+	for name, pref := range preferences {
+		if err := pref.apply(p, p.preference(name)); err != nil {
+			delete(p.prefs, name)
+			pref.apply(p, pref.fallback)
+		}
+	}
+}
+
+func (p *player) applyMinimap(value string) error {
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 1 || depth > 6 {
+		return fmt.Errorf("The minimap size must be between 1 and 6")
+	}
+	p.minimap = newMapBuilder(depth)
+	return nil
+}
+
+// List or change preferences
+func (p *player) doSet(cmd string) {
+	words := strings.Fields(cmd)
+	if len(words) == 0 {
+		names := []string{}
+		for name := range preferences {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		output := fmt.Sprintf("+%s+\n", strings.Repeat("-", 30))
+		output += fmt.Sprintf("|%s|\n", centerText("SETTINGS", 30, ' '))
+		output += fmt.Sprintf("+%s+\n", strings.Repeat("-", 30))
+		for _, name := range names {
+			pref := preferences[name]
+			value := ansiWrap(fmt.Sprintf("%-17s", p.preference(name)), colorValue)
+			output += fmt.Sprintf("| %-10s %s | %s (%s)\n", name, value, pref.description, pref.usage)
+		}
+		output += fmt.Sprintf("+%s+", strings.Repeat("-", 30))
+		p.send(event{
+			player: p,
+			output: output,
+		})
+		return
+	}
+	if len(words) != 2 {
+		p.send(event{
+			player: p,
+			output: "Usage: set <?setting> <?value>",
+			err:    true,
+		})
+		return
+	}
+
+	name, value := strings.ToLower(words[0]), strings.ToLower(words[1])
+	pref, exists := preferences[name]
+	if !exists {
+		p.send(event{
+			player: p,
+			output: "No such setting!",
+			err:    true,
+		})
+		return
+	}
+	if err := pref.apply(p, value); err != nil {
+		p.send(event{
+			player: p,
+			output: err.Error(),
+			err:    true,
+		})
+		return
+	}
+	p.prefs[name] = value
+	display := p.display
+	p.send(event{
+		player:  p,
+		output:  fmt.Sprintf("%s set to %s", name, value),
+		minimap: p.minimap.snapshot(p.room, p.visited),
+		display: &display,
+	})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Read zones, rooms and exits from the database again and swap them into the running world.
+// Players, mobiles and items keep their place by room id; anything in a room that no longer exists goes to the start room.
+// Returns a summary of what changed
+func reloadWorld() (string, error) {
+	oldZones, oldRooms := zones, rooms
+	err := readTransaction(func(tx *sql.Tx) error {
+		if err := readZones(tx); err != nil {
+			return err
+		}
+		if err := readRooms(tx); err != nil {
+			return err
+		}
+		return readExits(tx)
+	})
+	if err == nil {
+		err = checkConfigRooms()
+	}
+	if err != nil {
+		// Keep running on the old world
+		zones, rooms = oldZones, oldRooms
+		return "", err
+	}
+	summary := diffWorld(oldZones, oldRooms)
+	start := rooms[cfg.StartRoom]
+
+	// Carry over what lives in the rooms
+	for id, old := range oldRooms {
+		r, kept := rooms[id]
+		if !kept {
+			r = start
+			for _, it := range old.items {
+				if err := it.saveInRoom(r); err != nil {
+					serverLog.Printf("moving item %d out of deleted room %d: %v", it.id, id, err)
+				}
+				r.items = append(r.items, it)
+			}
+		} else {
+			r.items = append(r.items, old.items...)
+			// Doors that are still there stay open or closed as they were
+			for dir, e := range old.exits {
+				if e.door != nil && r.exits[dir].door != nil {
+					r.exits[dir].door.state = e.door.state
+				}
+			}
+		}
+		for _, m := range old.mobs {
+			m.room = r
+			r.mobs = append(r.mobs, m)
+		}
+	}
+	for _, m := range mobs {
+		m.home = relocate(m.home)
+	}
+
+	// Put players back where they were
+	for _, p := range players {
+		r, kept := rooms[p.room.id]
+		if !kept {
+			r = start
+		}
+		p.room = r
+		p.zone = r.zone
+		r.players = append(r.players, p)
+		r.zone.players = append(r.zone.players, p)
+		p.visited[r.id] = true
+		if !kept {
+			p.send(event{
+				player: p,
+				output: ansiWrap("The world shifts around you, and you find yourself somewhere else...", colorNotice),
+			})
+			p.printLocation()
+		}
+	}
+	for _, r := range rooms {
+		r.sortPlayers()
+	}
+	for _, z := range zones {
+		z.sortPlayers()
+	}
+	refreshMinimaps()
+	return summary, nil
+}
+
+// The room with the same id in the current world, or the start room if it is gone
+func relocate(old *room) *room {
+	if r, exists := rooms[old.id]; exists {
+		return r
+	}
+	return rooms[cfg.StartRoom]
+}
+
+// Describe the differences between an old world and the current one
+func diffWorld(oldZones map[int]*zone, oldRooms map[int]*room) string {
+	var zonesAdded, zonesRemoved, roomsAdded, roomsRemoved, roomsChanged, exitsAdded, exitsRemoved, exitsChanged int
+	for id := range zones {
+		if _, exists := oldZones[id]; !exists {
+			zonesAdded++
+		}
+	}
+	for id := range oldZones {
+		if _, exists := zones[id]; !exists {
+			zonesRemoved++
+		}
+	}
+	for id, r := range rooms {
+		old, exists := oldRooms[id]
+		if !exists {
+			roomsAdded++
+			for _, e := range r.exits {
+				if e.to != nil {
+					exitsAdded++
+				}
+			}
+			continue
+		}
+		if old.name != r.name || old.description != r.description || old.zone.id != r.zone.id || old.flags != r.flags {
+			roomsChanged++
+		}
+		for dir, e := range r.exits {
+			before := old.exits[dir]
+			switch {
+			case before.to == nil && e.to != nil:
+				exitsAdded++
+			case before.to != nil && e.to == nil:
+				exitsRemoved++
+			case before.to != nil && (before.to.id != e.to.id || before.description != e.description):
+				exitsChanged++
+			}
+		}
+	}
+	for id, old := range oldRooms {
+		if _, exists := rooms[id]; !exists {
+			roomsRemoved++
+			for _, e := range old.exits {
+				if e.to != nil {
+					exitsRemoved++
+				}
+			}
+		}
+	}
+
+	changes := []string{}
+	count := func(n int, what string, how string) {
+		if n > 0 {
+			changes = append(changes, fmt.Sprintf("%d %s %s", n, plural(n, what), how))
+		}
+	}
+	count(zonesAdded, "zone", "added")
+	count(zonesRemoved, "zone", "removed")
+	count(roomsAdded, "room", "added")
+	count(roomsRemoved, "room", "removed")
+	count(roomsChanged, "room", "changed")
+	count(exitsAdded, "exit", "added")
+	count(exitsRemoved, "exit", "removed")
+	count(exitsChanged, "exit", "changed")
+	if len(changes) == 0 {
+		return "nothing changed"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// Reload the world and report how it went
+func reloadAndReport(p *player) {
+	summary, err := reloadWorld()
+	if err != nil {
+		serverLog.Printf("reloading world: %v", err)
+		if p != nil {
+			p.send(event{
+				player: p,
+				output: fmt.Sprintf("Reload failed, the world is unchanged: %v", err),
+				err:    true,
+			})
+		}
+		return
+	}
+	serverLog.Printf("Reloaded world: %s", summary)
+	if p != nil {
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("Reloaded the world: %s.", summary),
+		})
+	}
+}
+
+// Administration
+
+func (p *player) doReload(_ string) {
+	reloadAndReport(p)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	autosaveInterval = 5 * time.Minute
+)
+
+// Load saved state for a player who just logged in, before they enter the world.
+// Only the database is read here; the world itself is left to the world goroutine
+func (p *player) loadState() error {
+	err := readTransaction(func(tx *sql.Tx) error {
+		var (
+			roomID   int
+			playTime int64
+			rank     string
+		)
+		if err := tx.QueryRow("SELECT rank FROM accounts WHERE name = ?", p.name).Scan(&rank); err != nil {
+			return fmt.Errorf("reading rank: %v", err)
+		}
+		p.rank = ranks[rank]
+
+		row := tx.QueryRow("SELECT room_id, play_time, hit_points, max_hit_points, strength, dexterity FROM players WHERE name = ?", p.name)
+		var s stats
+		switch err := row.Scan(&roomID, &playTime, &s.hp, &s.maxHP, &s.strength, &s.dexterity); {
+		case err == sql.ErrNoRows:
+			// First time playing
+			return nil
+		case err != nil:
+			return fmt.Errorf("reading player: %v", err)
+		}
+		p.playTime = time.Duration(playTime) * time.Second
+		p.lastRoom = roomID
+		p.stats = s
+
+		// Visited rooms
+		if err := readVisited(tx, p.name, p.visited); err != nil {
+			return err
+		}
+
+		// Preferences
+		prefRows, err := tx.Query("SELECT key, value FROM preferences WHERE player = ?", p.name)
+		if err != nil {
+			return fmt.Errorf("querying preferences: %v", err)
+		}
+		defer prefRows.Close()
+		for prefRows.Next() {
+			var key, value string
+			if err := prefRows.Scan(&key, &value); err != nil {
+				return fmt.Errorf("reading a preference: %v", err)
+			}
+			p.prefs[key] = value
+		}
+		if err := prefRows.Err(); err != nil {
+			return fmt.Errorf("iterating over preferences: %v", err)
+		}
+
+		// Bookmarks
+		markRows, err := tx.Query("SELECT name, room_id FROM bookmarks WHERE player = ?", p.name)
+		if err != nil {
+			return fmt.Errorf("querying bookmarks: %v", err)
+		}
+		defer markRows.Close()
+		for markRows.Next() {
+			var (
+				name string
+				id   int
+			)
+			if err := markRows.Scan(&name, &id); err != nil {
+				return fmt.Errorf("reading a bookmark: %v", err)
+			}
+			p.bookmarks[name] = id
+		}
+		if err := markRows.Err(); err != nil {
+			return fmt.Errorf("iterating over bookmarks: %v", err)
+		}
+
+		// Colors
+		colorRows, err := tx.Query("SELECT kind, color FROM colors WHERE player = ?", p.name)
+		if err != nil {
+			return fmt.Errorf("querying colors: %v", err)
+		}
+		defer colorRows.Close()
+		for colorRows.Next() {
+			var kind, color string
+			if err := colorRows.Scan(&kind, &color); err != nil {
+				return fmt.Errorf("reading a color: %v", err)
+			}
+			// Kinds and colors that are no longer known are dropped
+			if _, known := parseColorKind(kind); !known {
+				continue
+			}
+			if _, err := parseColor(color); err == nil {
+				p.colors[kind] = color
+			}
+		}
+		if err := colorRows.Err(); err != nil {
+			return fmt.Errorf("iterating over colors: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.applyPreferences()
+	return nil
+}
+
+// Write the player's location, stats, visited rooms, play time, preferences, bookmarks and colors
+func (p *player) save() error {
+	return writeTransaction(func(tx *sql.Tx) error {
+		playTime := p.playTime + time.Since(p.beginTime)
+		_, err := tx.Exec(`INSERT INTO players (name, room_id, play_time, last_seen, hit_points, max_hit_points, strength, dexterity) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(name) DO UPDATE SET room_id = excluded.room_id, play_time = excluded.play_time, last_seen = excluded.last_seen,
+				hit_points = excluded.hit_points, max_hit_points = excluded.max_hit_points, strength = excluded.strength, dexterity = excluded.dexterity`,
+			p.name, p.room.id, int64(playTime/time.Second), time.Now().Unix(), p.stats.hp, p.stats.maxHP, p.stats.strength, p.stats.dexterity)
+		if err != nil {
+			return fmt.Errorf("saving player: %v", err)
+		}
+
+		visit, err := tx.Prepare("INSERT OR IGNORE INTO visited (player, room_id) VALUES (?, ?)")
+		if err != nil {
+			return fmt.Errorf("preparing visited rooms: %v", err)
+		}
+		defer visit.Close()
+		for id := range p.visited {
+			if _, err := visit.Exec(p.name, id); err != nil {
+				return fmt.Errorf("saving visited room %d: %v", id, err)
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM preferences WHERE player = ?", p.name); err != nil {
+			return fmt.Errorf("clearing preferences: %v", err)
+		}
+		for key, value := range p.prefs {
+			if _, err := tx.Exec("INSERT INTO preferences (player, key, value) VALUES (?, ?, ?)", p.name, key, value); err != nil {
+				return fmt.Errorf("saving preference '%s': %v", key, err)
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM bookmarks WHERE player = ?", p.name); err != nil {
+			return fmt.Errorf("clearing bookmarks: %v", err)
+		}
+		for name, id := range p.bookmarks {
+			if _, err := tx.Exec("INSERT INTO bookmarks (player, name, room_id) VALUES (?, ?, ?)", p.name, name, id); err != nil {
+				return fmt.Errorf("saving bookmark '%s': %v", name, err)
+			}
+		}
+
+		if _, err := tx.Exec("DELETE FROM colors WHERE player = ?", p.name); err != nil {
+			return fmt.Errorf("clearing colors: %v", err)
+		}
+		for kind, color := range p.colors {
+			if _, err := tx.Exec("INSERT INTO colors (player, kind, color) VALUES (?, ?, ?)", p.name, kind, color); err != nil {
+				return fmt.Errorf("saving color '%s': %v", kind, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Save every player on the server
+func saveAll() {
+	for _, p := range players {
+		// Still logging in, with nothing loaded to save yet
+		if p.room == nil {
+			continue
+		}
+		if err := p.save(); err != nil {
+			serverLog.Printf("saving player '%s': %v", p.name, err)
+		}
+	}
+}
+
+// Read the rooms a player has visited into a set
+func readVisited(tx *sql.Tx, name string, visited map[int]bool) error {
+	rows, err := tx.Query("SELECT room_id FROM visited WHERE player = ?", name)
+	if err != nil {
+		return fmt.Errorf("querying visited rooms: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("reading a visited room: %v", err)
+		}
+		visited[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterating over visited rooms: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+)
+
+const (
+	pulseInterval = 100 * time.Millisecond // How often the main loop runs due callbacks
+	gameHour      = time.Minute            // Real time per hour of game time
+	hoursPerDay   = 24
+)
+
+var (
+	sched    *scheduler // Runs timed world events on the main goroutine
+	gameTime int        // Hours of game time since the server started
+)
+
+// Where the scheduler gets the time from.
+// Anything that can report a time will do, so the scheduler can be driven by hand instead of by the wall clock
+type clock interface {
+	now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) now() time.Time {
+	return time.Now()
+}
+
+// A callback waiting to run
+type timer struct {
+	due      time.Time
+	interval time.Duration // Zero for callbacks that run once
+	run      func()
+	seq      int // Breaks ties so callbacks due together run in the order they were added
+	index    int // Position in the queue, -1 once removed
+}
+
+// Timers ordered by when they are due
+type timerQueue []*timer
+
+func (q timerQueue) Len() int { return len(q) }
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].due.Equal(q[j].due) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].due.Before(q[j].due)
+}
+func (q timerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *timerQueue) Push(x interface{}) {
+	t := x.(*timer)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*q = old[:len(old)-1]
+	return t
+}
+
+// Runs callbacks once their time has come.
+// It is not safe for concurrent use; the main goroutine calls run on every pulse
+type scheduler struct {
+	clock  clock
+	timers timerQueue
+	seq    int
+}
+
+func newScheduler(c clock) *scheduler {
+	return &scheduler{clock: c}
+}
+
+// Run f once, after d has passed
+func (s *scheduler) after(d time.Duration, f func()) *timer {
+	return s.add(d, 0, f)
+}
+
+// Run f every d, starting d from now
+func (s *scheduler) every(d time.Duration, f func()) *timer {
+	if d <= 0 {
+		panic(fmt.Sprintf("scheduler: non-positive interval %v", d))
+	}
+	return s.add(d, d, f)
+}
+
+func (s *scheduler) add(d time.Duration, interval time.Duration, f func()) *timer {
+	s.seq++
+	t := &timer{
+		due:      s.clock.now().Add(d),
+		interval: interval,
+		run:      f,
+		seq:      s.seq,
+	}
+	heap.Push(&s.timers, t)
+	return t
+}
+
+// Stop a timer from running again. Cancelling twice does nothing
+func (s *scheduler) cancel(t *timer) {
+	if t != nil && t.index >= 0 {
+		heap.Remove(&s.timers, t.index)
+	}
+}
+
+// Run every callback that is due, earliest first.
+// Repeating callbacks that fell more than one interval behind skip the beats they missed
+func (s *scheduler) run() {
+	now := s.clock.now()
+	for len(s.timers) > 0 && !s.timers[0].due.After(now) {
+		t := heap.Pop(&s.timers).(*timer)
+		if t.interval > 0 {
+			t.due = t.due.Add(t.interval)
+			if !t.due.After(now) {
+				t.due = now.Add(t.interval)
+			}
+			s.seq++
+			t.seq = s.seq
+			heap.Push(&s.timers, t)
+		}
+		t.run()
+	}
+}
+
+// Set up the recurring world events
+func startPulses() {
+	sched.every(autosaveInterval, saveAll)
+	sched.every(wanderInterval, wanderMobs)
+	sched.every(gameHour, advanceGameTime)
+	sched.every(combatRound, fightRound)
+	sched.every(regenInterval, regenerate)
+}
+
+// Move game time forward an hour, letting players know when the sun comes and goes
+func advanceGameTime() {
+	gameTime++
+	switch gameTime % hoursPerDay {
+	case 6:
+		announceTime("The sun rises in the east.")
+	case 20:
+		announceTime("The sun slowly disappears in the west.")
+	}
+}
+
+// Describe the time of day, e.g. "3 o'clock in the afternoon on day 2"
+func describeGameTime() string {
+	hour, day := gameTime%hoursPerDay, gameTime/hoursPerDay+1
+	clockHour := hour % 12
+	if clockHour == 0 {
+		clockHour = 12
+	}
+	var part string
+	switch {
+	case hour < 6:
+		part = "at night"
+	case hour < 12:
+		part = "in the morning"
+	case hour < 18:
+		part = "in the afternoon"
+	default:
+		part = "in the evening"
+	}
+	return fmt.Sprintf("%d o'clock %s on day %d", clockHour, part, day)
+}
+
+// Tell every player about the passing of time
+func announceTime(msg string) {
+	for _, p := range players {
+		p.send(event{
+			output: msg,
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A clock that only moves when the test advances it
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestScheduler() (*scheduler, *fakeClock) {
+	c := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return newScheduler(c), c
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	s, c := newTestScheduler()
+	var ran []string
+	s.after(3*time.Second, func() { ran = append(ran, "third") })
+	s.after(time.Second, func() { ran = append(ran, "first") })
+	s.after(2*time.Second, func() { ran = append(ran, "second") })
+	s.after(2*time.Second, func() { ran = append(ran, "second, added later") })
+
+	s.run()
+	if len(ran) != 0 {
+		t.Fatalf("ran %v before anything was due", ran)
+	}
+	c.advance(2 * time.Second)
+	s.run()
+	want := []string{"first", "second", "second, added later"}
+	if !reflect.DeepEqual(ran, want) {
+		t.Fatalf("after 2s ran %v, want %v", ran, want)
+	}
+	c.advance(time.Second)
+	s.run()
+	want = append(want, "third")
+	if !reflect.DeepEqual(ran, want) {
+		t.Fatalf("after 3s ran %v, want %v", ran, want)
+	}
+	c.advance(time.Hour)
+	s.run()
+	if len(ran) != len(want) {
+		t.Fatalf("one-off callbacks ran again: %v", ran)
+	}
+}
+
+func TestSchedulerEvery(t *testing.T) {
+	s, c := newTestScheduler()
+	count := 0
+	s.every(time.Second, func() { count++ })
+	for i := 1; i <= 5; i++ {
+		c.advance(time.Second)
+		s.run()
+		if count != i {
+			t.Fatalf("after %d beats ran %d times", i, count)
+		}
+	}
+	// Nothing more until the next beat
+	c.advance(500 * time.Millisecond)
+	s.run()
+	if count != 5 {
+		t.Fatalf("ran %d times between beats, want 5", count)
+	}
+}
+
+func TestSchedulerMissedBeats(t *testing.T) {
+	s, c := newTestScheduler()
+	count := 0
+	s.every(time.Second, func() { count++ })
+
+	// A stall of ten beats runs the callback once, not ten times
+	c.advance(10 * time.Second)
+	s.run()
+	if count != 1 {
+		t.Fatalf("ran %d times after missing beats, want 1", count)
+	}
+	// And the next beat is a whole interval after the late run
+	c.advance(999 * time.Millisecond)
+	s.run()
+	if count != 1 {
+		t.Fatalf("ran %d times before the next beat, want 1", count)
+	}
+	c.advance(time.Millisecond)
+	s.run()
+	if count != 2 {
+		t.Fatalf("ran %d times at the next beat, want 2", count)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s, c := newTestScheduler()
+	ran := map[string]bool{}
+	once := s.after(time.Second, func() { ran["once"] = true })
+	repeating := s.every(time.Second, func() { ran["repeating"] = true })
+	var later *timer
+	// Cancelled by a callback that runs first in the same pulse
+	s.after(500*time.Millisecond, func() { s.cancel(later) })
+	later = s.after(time.Second, func() { ran["later"] = true })
+	kept := s.after(time.Second, func() { ran["kept"] = true })
+
+	s.cancel(once)
+	s.cancel(once)
+	c.advance(time.Second)
+	s.run()
+	if ran["once"] || ran["later"] {
+		t.Fatalf("cancelled callbacks ran: %v", ran)
+	}
+	if !ran["repeating"] || !ran["kept"] {
+		t.Fatalf("callbacks that weren't cancelled didn't run: %v", ran)
+	}
+
+	s.cancel(repeating)
+	s.cancel(kept)
+	ran = map[string]bool{}
+	c.advance(time.Minute)
+	s.run()
+	if len(ran) != 0 {
+		t.Fatalf("cancelled callbacks ran: %v", ran)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	shutdownCountdown = 10 // Seconds of warning players get before the server goes down
+)
+
+var (
+	countdown       *timer // Scheduled while a shutdown is pending
+	countdownLeft   int    // Seconds until shutdown
+	countdownReboot bool   // Whether the server comes back up through a copyover
+)
+
+// Start warning players about a shutdown.
+// Asking again while counting down shuts down immediately
+func beginShutdown(reboot bool) {
+	if countdown != nil {
+		finishShutdown()
+		return
+	}
+	countdownReboot = reboot
+	countdownLeft = shutdownCountdown
+	countdown = sched.every(time.Second, shutdownTick)
+	announceShutdown()
+}
+
+// Count down one second
+func shutdownTick() {
+	countdownLeft--
+	switch {
+	case countdownLeft <= 0:
+		finishShutdown()
+	case countdownLeft <= 3 || countdownLeft%5 == 0:
+		announceShutdown()
+	}
+}
+
+func announceShutdown() {
+	action := "shutting down"
+	if countdownReboot {
+		action = "rebooting"
+	}
+	broadcast(fmt.Sprintf("The server is %s in %d %s!", action, countdownLeft, plural(countdownLeft, "second")))
+}
+
+// Send a server notice to every player
+func broadcast(msg string) {
+	for _, p := range players {
+		p.send(event{
+			output: ansiWrap(msg, colorNotice),
+		})
+	}
+}
+
+func finishShutdown() {
+	sched.cancel(countdown)
+	if countdownReboot {
+		// Only returns if the new process could not be started, leaving the rest of the shutdown to do
+		copyover()
+	}
+	shutdown()
+}
+
+// Save and disconnect everyone, then exit
+func shutdown() {
+	serverLog.Println("Shutting down...")
+	for _, p := range players {
+		p.leaveWorld()
+	}
+	// Let every client see its goodbye message
+	writers.Wait()
+	if err := db.Close(); err != nil {
+		serverLog.Printf("closing database: %v", err)
+	}
+	serverLog.Println("Server stopped")
+	os.Exit(0)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	maxSpeedwalk = 50 // The most steps one speedwalk can take
+)
+
+// Read a whole line as a speedwalk before it is taken as a command.
+// A line starting with "." always is one. Otherwise it needs a count or more than one word,
+// so "n 2e" and "u w" take every step while single words like "news" are left to the commands
+func lineSpeedwalk(text string) ([]int, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, ".") && !strings.ContainsAny(text, "0123456789") && len(strings.Fields(text)) < 2 {
+		return nil, false
+	}
+	return parseSpeedwalk(text)
+}
+
+// Parse a speedwalk like "3n2e u w" or ".nnneeu" into exit indexes.
+// Each letter is a direction and may be preceded by a count. Returns false if the text isn't a speedwalk
+func parseSpeedwalk(text string) ([]int, bool) {
+	text = strings.TrimPrefix(strings.TrimSpace(text), ".")
+	steps := []int{}
+	count := 0
+	for _, c := range strings.ToLower(text) {
+		switch {
+		case unicode.IsDigit(c):
+			count = count*10 + int(c-'0')
+			if count > maxSpeedwalk {
+				return nil, false
+			}
+		case unicode.IsSpace(c):
+			if count != 0 {
+				// A count has to go with a direction
+				return nil, false
+			}
+		default:
+			dir, exists := dirRuneToInt[c]
+			if !exists {
+				return nil, false
+			}
+			if count == 0 {
+				count = 1
+			}
+			for ; count > 0; count-- {
+				steps = append(steps, dir)
+			}
+		}
+	}
+	if count != 0 || len(steps) == 0 || len(steps) > maxSpeedwalk {
+		return nil, false
+	}
+	return steps, true
+}
+
+// Walk each step in turn, stopping at the first exit that can't be taken
+func (p *player) speedwalk(steps []int) {
+	for _, dir := range steps {
+		e := p.room.exits[dir]
+		// Gives the usual reason if the way is blocked
+		p.moveDirection(dir)
+		if e.to == nil || e.blocked() {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSpeedwalk(t *testing.T) {
+	createMaps()
+	n, e, w, s, u, d := 0, 1, 2, 3, 4, 5
+	tests := []struct {
+		text  string
+		steps []int
+		ok    bool
+	}{
+		{"n", []int{n}, true},
+		{"3n2e u w", []int{n, n, n, e, e, u, w}, true},
+		{".nnneeu", []int{n, n, n, e, e, u}, true},
+		{"  .2S d ", []int{s, s, d}, true},
+		{"12w", []int{w, w, w, w, w, w, w, w, w, w, w, w}, true},
+		{"50n", repeat(n, 50), true},
+		// Too far in one count, or all together
+		{"51n", nil, false},
+		{"99999999999999999999n", nil, false},
+		{"30n30s", nil, false},
+		// A count needs a direction after it
+		{"3", nil, false},
+		{"2e 3", nil, false},
+		{"3 n", nil, false},
+		{"", nil, false},
+		{".", nil, false},
+		{"news2", nil, false},
+		{"look", nil, false},
+	}
+	for _, test := range tests {
+		steps, ok := parseSpeedwalk(test.text)
+		if ok != test.ok || !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("parseSpeedwalk(%q) = %v, %v, want %v, %v", test.text, steps, ok, test.steps, test.ok)
+		}
+	}
+}
+
+func TestLineSpeedwalk(t *testing.T) {
+	createMaps()
+	n, e, w, s := 0, 1, 2, 3
+	tests := []struct {
+		text  string
+		steps []int
+		ok    bool
+	}{
+		// Single words are commands, even when they are made of directions
+		{"news", nil, false},
+		{"sew", nil, false},
+		{"n", nil, false},
+		// Unless they start with a "." or have a count
+		{".news", []int{n, e, w, s}, true},
+		{".n", []int{n}, true},
+		{"2n", []int{n, n}, true},
+		{"n 2e", []int{n, e, e}, true},
+		{"n s", []int{n, s}, true},
+		// Lines that look like a speedwalk but aren't one are left to the commands
+		{"tell amy 2", nil, false},
+		{"get 2 swords", nil, false},
+		{".look", nil, false},
+		{"60n", nil, false},
+		{"n 2", nil, false},
+	}
+	for _, test := range tests {
+		steps, ok := lineSpeedwalk(test.text)
+		if ok != test.ok || !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("lineSpeedwalk(%q) = %v, %v, want %v, %v", test.text, steps, ok, test.steps, test.ok)
+		}
+	}
+}
+
+func repeat(dir int, count int) []int {
+	steps := []int{}
+	for i := 0; i < count; i++ {
+		steps = append(steps, dir)
+	}
+	return steps
+}
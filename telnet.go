@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"sync"
+)
+
+// Telnet protocol bytes (RFC 854)
+const (
+	iac  byte = 255 // Interpret as command
+	dont byte = 254
+	do   byte = 253
+	wont byte = 252
+	will byte = 251
+	sb   byte = 250 // Subnegotiation begin
+	se   byte = 240 // Subnegotiation end
+)
+
+// Telnet options
+const (
+	optEcho  byte = 1  // RFC 857
+	optSGA   byte = 3  // Suppress go ahead (RFC 858)
+	optTType byte = 24 // Terminal type (RFC 1091)
+	optNAWS  byte = 31 // Negotiate about window size (RFC 1073)
+)
+
+// Terminal type subnegotiation commands
+const (
+	ttypeIs   byte = 0
+	ttypeSend byte = 1
+)
+
+// Limits on what a client can make the server keep
+const (
+	maxSubLen   = 128 // Bytes of a subnegotiation, the rest is dropped
+	maxTTypeLen = 40  // Characters of a terminal type
+)
+
+// Parser states for incoming telnet bytes
+const (
+	stateData = iota
+	stateIAC
+	stateOption
+	stateSub
+	stateSubIAC
+	stateCR
+)
+
+// A connection that speaks the telnet protocol.
+// Reads return only user data; IAC sequences are stripped and answered.
+type telnetConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	// Parser state, only touched by the reading goroutine
+	state int
+	verb  byte   // The negotiation verb being parsed
+	sub   []byte // The current subnegotiation buffer
+
+	mu      sync.Mutex    // Guards the fields below, which are written while reading
+	enabled map[byte]bool // Options the server has agreed to perform
+	width   int
+	height  int
+	ttype   string
+}
+
+// Wrap a connection and start option negotiation
+func newTelnetConn(conn net.Conn) *telnetConn {
+	t := &telnetConn{
+		Conn:    conn,
+		r:       bufio.NewReader(conn),
+		enabled: make(map[byte]bool),
+		width:   cfg.ScreenWidth,
+		height:  cfg.ScreenHeight,
+	}
+	t.command(will, optSGA)
+	t.command(do, optNAWS)
+	t.command(do, optTType)
+	t.enabled[optSGA] = true
+	return t
+}
+
+// Read user data, handling any telnet commands along the way
+func (t *telnetConn) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		// Only block if nothing has been read yet
+		if n > 0 && t.r.Buffered() == 0 {
+			break
+		}
+		c, err := t.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if data, ok := t.parse(c); ok {
+			b[n] = data
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Write data, escaping any literal IAC bytes
+func (t *telnetConn) Write(b []byte) (int, error) {
+	escaped := b
+	for i, c := range b {
+		if c == iac {
+			escaped = make([]byte, 0, len(b)+1)
+			escaped = append(escaped, b[:i]...)
+			for _, c := range b[i:] {
+				if c == iac {
+					escaped = append(escaped, iac)
+				}
+				escaped = append(escaped, c)
+			}
+			break
+		}
+	}
+	if _, err := t.Conn.Write(escaped); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Feed one byte to the parser. Returns the byte if it is user data
+func (t *telnetConn) parse(c byte) (byte, bool) {
+	switch t.state {
+	case stateCR:
+		t.state = stateData
+		// Some clients end lines with CR NUL
+		if c == 0 {
+			return '\n', true
+		}
+		fallthrough
+	case stateData:
+		switch c {
+		case iac:
+			t.state = stateIAC
+			return 0, false
+		case '\r':
+			t.state = stateCR
+		}
+		return c, true
+	case stateIAC:
+		switch c {
+		case iac:
+			// Escaped literal 255
+			t.state = stateData
+			return c, true
+		case do, dont, will, wont:
+			t.verb = c
+			t.state = stateOption
+		case sb:
+			t.sub = t.sub[:0]
+			t.state = stateSub
+		default:
+			// NOP, GA, etc.
+			t.state = stateData
+		}
+	case stateOption:
+		t.negotiate(t.verb, c)
+		t.state = stateData
+	case stateSub:
+		if c == iac {
+			t.state = stateSubIAC
+		} else if len(t.sub) < maxSubLen {
+			t.sub = append(t.sub, c)
+		}
+	case stateSubIAC:
+		switch c {
+		case se:
+			t.subnegotiate(t.sub)
+			t.state = stateData
+		case iac:
+			if len(t.sub) < maxSubLen {
+				t.sub = append(t.sub, iac)
+			}
+			t.state = stateSub
+		default:
+			// Malformed, drop the subnegotiation
+			t.state = stateData
+		}
+	}
+	return 0, false
+}
+
+// Respond to an option request from the client
+func (t *telnetConn) negotiate(verb, opt byte) {
+	switch verb {
+	case will:
+		switch opt {
+		case optTType:
+			t.subcommand(optTType, ttypeSend)
+		case optNAWS:
+			// Size will arrive in a subnegotiation
+		default:
+			t.command(dont, opt)
+		}
+	case do:
+		switch opt {
+		case optSGA, optEcho:
+			if !t.setEnabled(opt, true) {
+				t.command(will, opt)
+			}
+		default:
+			t.command(wont, opt)
+		}
+	case dont:
+		if t.setEnabled(opt, false) {
+			t.command(wont, opt)
+		}
+	}
+}
+
+// Record whether a server side option is enabled. Returns the previous state
+func (t *telnetConn) setEnabled(opt byte, on bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	was := t.enabled[opt]
+	t.enabled[opt] = on
+	return was
+}
+
+// Handle a completed subnegotiation
+func (t *telnetConn) subnegotiate(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	switch data[0] {
+	case optNAWS:
+		if len(data) < 5 {
+			return
+		}
+		w := int(data[1])<<8 | int(data[2])
+		h := int(data[3])<<8 | int(data[4])
+		t.mu.Lock()
+		// Zero means unknown
+		if w > 0 {
+			t.width = w
+		}
+		if h > 0 {
+			t.height = h
+		}
+		t.mu.Unlock()
+	case optTType:
+		if len(data) < 2 || data[1] != ttypeIs {
+			return
+		}
+		t.mu.Lock()
+		t.ttype = cleanTerminalType(string(data[2:]))
+		t.mu.Unlock()
+	}
+}
+
+// Keep only the printable ASCII of a terminal type, up to maxTTypeLen characters
+func cleanTerminalType(ttype string) string {
+	clean := []byte{}
+	for i := 0; i < len(ttype) && len(clean) < maxTTypeLen; i++ {
+		if ttype[i] >= ' ' && ttype[i] <= '~' {
+			clean = append(clean, ttype[i])
+		}
+	}
+	return string(clean)
+}
+
+// Send a 3 byte negotiation command
+func (t *telnetConn) command(verb, opt byte) {
+	t.Conn.Write([]byte{iac, verb, opt})
+}
+
+// Send a subnegotiation
+func (t *telnetConn) subcommand(opt byte, data ...byte) {
+	msg := []byte{iac, sb, opt}
+	for _, c := range data {
+		if c == iac {
+			msg = append(msg, iac)
+		}
+		msg = append(msg, c)
+	}
+	t.Conn.Write(append(msg, iac, se))
+}
+
+// Turn client side echo on or off.
+// When off the server claims to echo, which hides typed text such as passwords
+func (t *telnetConn) setEcho(on bool) {
+	if on {
+		if t.setEnabled(optEcho, false) {
+			t.command(wont, optEcho)
+		}
+	} else {
+		if !t.setEnabled(optEcho, true) {
+			t.command(will, optEcho)
+		}
+	}
+}
+
+// The last reported screen size
+func (t *telnetConn) size() (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.width, t.height
+}
+
+// The reported terminal type, if any
+func (t *telnetConn) terminalType() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ttype
+}
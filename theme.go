@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A kind of output, colored by each player's theme
+type colorKind int
+
+const (
+	colorEmote colorKind = iota
+	colorNav
+	colorError
+	colorChannel // Said, shouted and gossiped words
+	colorPlayer  // Other players' names
+	colorYou     // The player's own name
+	colorMobile
+	colorItem
+	colorExit
+	colorDoor // Closed doors in exit lists
+	colorValue
+	colorNotice // Messages from the server itself
+	colorHurt
+	colorMapYou
+	colorMapUnexplored
+	colorMapZone // Exits into other zones
+	colorMapElsewhere
+	colorMapDoor
+)
+
+var (
+	// The names players use for each kind of output, in the order they are listed
+	colorKinds = []string{
+		colorEmote:         "emote",
+		colorNav:           "nav",
+		colorError:         "error",
+		colorChannel:       "channel",
+		colorPlayer:        "player",
+		colorYou:           "you",
+		colorMobile:        "mobile",
+		colorItem:          "item",
+		colorExit:          "exit",
+		colorDoor:          "door",
+		colorValue:         "value",
+		colorNotice:        "notice",
+		colorHurt:          "hurt",
+		colorMapYou:        "map-you",
+		colorMapUnexplored: "map-unexplored",
+		colorMapZone:       "map-zone",
+		colorMapElsewhere:  "map-elsewhere",
+		colorMapDoor:       "map-door",
+	}
+
+	basicColors = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+	// Built in themes, by name. Kinds a theme leaves out are not colored
+	themes = map[string]map[colorKind]string{
+		"default": {
+			colorEmote:         "white",
+			colorNav:           "cyan",
+			colorError:         "red",
+			colorChannel:       "yellow",
+			colorPlayer:        "yellow",
+			colorYou:           "green",
+			colorMobile:        "magenta",
+			colorItem:          "green",
+			colorExit:          "cyan",
+			colorDoor:          "yellow",
+			colorValue:         "green",
+			colorNotice:        "magenta",
+			colorHurt:          "red",
+			colorMapYou:        "red",
+			colorMapUnexplored: "cyan",
+			colorMapZone:       "magenta",
+			colorMapElsewhere:  "green",
+			colorMapDoor:       "yellow",
+		},
+		// Dark colors for light backgrounds
+		"light": {
+			colorNav:           "blue",
+			colorError:         "red",
+			colorChannel:       "130",
+			colorPlayer:        "94",
+			colorYou:           "22",
+			colorMobile:        "magenta",
+			colorItem:          "22",
+			colorExit:          "blue",
+			colorDoor:          "130",
+			colorValue:         "22",
+			colorNotice:        "magenta",
+			colorHurt:          "red",
+			colorMapYou:        "red",
+			colorMapUnexplored: "blue",
+			colorMapZone:       "magenta",
+			colorMapElsewhere:  "22",
+			colorMapDoor:       "130",
+		},
+		// Softer colors for terminals with true color
+		"pastel": {
+			colorEmote:         "#e4e4e4",
+			colorNav:           "#8fd7ff",
+			colorError:         "#ff7f7f",
+			colorChannel:       "#ffd787",
+			colorPlayer:        "#ffd787",
+			colorYou:           "#afffaf",
+			colorMobile:        "#d7afff",
+			colorItem:          "#afd7af",
+			colorExit:          "#8fd7ff",
+			colorDoor:          "#ffaf5f",
+			colorValue:         "#afffaf",
+			colorNotice:        "#d7afff",
+			colorHurt:          "#ff7f7f",
+			colorMapYou:        "#ff7f7f",
+			colorMapUnexplored: "#8fd7ff",
+			colorMapZone:       "#d7afff",
+			colorMapElsewhere:  "#afd7af",
+			colorMapDoor:       "#ffaf5f",
+		},
+	}
+)
+
+// Turn a color into SGR parameters. Accepts the eight basic color names, optionally prefixed with "bright-",
+// a number from the 256 color palette, "#rrggbb" for true color or "none"
+func parseColor(color string) (string, error) {
+	color = strings.ToLower(color)
+	if color == "none" {
+		return "", nil
+	}
+	if strings.HasPrefix(color, "#") {
+		if rgb, err := strconv.ParseUint(color[1:], 16, 32); err == nil && len(color) == 7 {
+			return fmt.Sprintf("38;2;%d;%d;%d", rgb>>16, rgb>>8&0xff, rgb&0xff), nil
+		}
+	} else if n, err := strconv.Atoi(color); err == nil {
+		if n >= 0 && n <= 255 {
+			return fmt.Sprintf("38;5;%d", n), nil
+		}
+	} else {
+		base := 30
+		if strings.HasPrefix(color, "bright-") {
+			color, base = strings.TrimPrefix(color, "bright-"), 90
+		}
+		if idx := index(len(basicColors), func(idx int) bool { return basicColors[idx] == color }); idx != -1 {
+			return strconv.Itoa(base + idx), nil
+		}
+	}
+	return "", fmt.Errorf("Unknown color '%s'. Use a name like red or bright-red, a number from 0 to 255, #rrggbb or none", color)
+}
+
+// Find a kind of output by name
+func parseColorKind(name string) (colorKind, bool) {
+	idx := index(len(colorKinds), func(idx int) bool { return colorKinds[idx] == strings.ToLower(name) })
+	return colorKind(idx), idx != -1
+}
+
+// Work out the player's colors from their theme and overrides
+func (p *player) buildPalette() {
+	palette := make(map[colorKind]string)
+	for kind, color := range themes[p.theme] {
+		palette[kind], _ = parseColor(color)
+	}
+	for name, color := range p.colors {
+		kind, _ := parseColorKind(name)
+		palette[kind], _ = parseColor(color)
+	}
+	// A new map each time, as the writing goroutine may still be reading the old one
+	p.display.palette = palette
+}
+
+func (p *player) applyTheme(value string) error {
+	if _, exists := themes[value]; !exists {
+		return fmt.Errorf("Unknown theme. Choose from %s", strings.Join(themeNames(), ", "))
+	}
+	p.theme = value
+	p.buildPalette()
+	return nil
+}
+
+func themeNames() []string {
+	names := []string{}
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Replace the kinds of output marked by ansiWrap with this display's colors, or remove all colors if they are off
+func (d displayMode) paint(text string) string {
+	if !d.color {
+		return stripANSI(text)
+	}
+	var w strings.Builder
+	for col := 0; col < len(text); {
+		next, _ := advance(text, col)
+		code := text[col:next]
+		if strings.HasPrefix(code, "\x1b[=") && strings.HasSuffix(code, "m") {
+			kind, _ := strconv.Atoi(code[3 : len(code)-1])
+			if sgr := d.palette[colorKind(kind)]; sgr != "" {
+				fmt.Fprintf(&w, "\x1b[%sm", sgr)
+			}
+		} else {
+			w.WriteString(code)
+		}
+		col = next
+	}
+	return w.String()
+}
+
+// Special
+
+// List the colors used for each kind of output, or change them
+func (p *player) doColor(cmd string) {
+	words := strings.Fields(strings.ToLower(cmd))
+	switch {
+	case len(words) == 0:
+		output := fmt.Sprintf("Theme: %s (change it with 'set theme <%s>')\n", p.theme, strings.Join(themeNames(), "|"))
+		for kind, name := range colorKinds {
+			color, overridden := p.colors[name]
+			if !overridden {
+				if color = themes[p.theme][colorKind(kind)]; color == "" {
+					color = "none"
+				}
+			}
+			line := fmt.Sprintf("  %-15s %s", name, ansiWrap(color, colorKind(kind)))
+			if overridden {
+				line += " (yours)"
+			}
+			output += line + "\n"
+		}
+		output += "Use 'color <kind> <color>' to change one, 'color <kind> reset' to go back to the theme's, or 'color reset' for all"
+		p.send(event{
+			player: p,
+			output: output,
+		})
+		return
+	case len(words) == 1 && words[0] == "reset":
+		p.colors = make(map[string]string)
+		p.buildPalette()
+		p.sendDisplay("All colors are back to the theme's.")
+		return
+	case len(words) != 2:
+		p.send(event{
+			player: p,
+			output: "Usage: color [<kind> <color|reset>] | color reset",
+			err:    true,
+		})
+		return
+	}
+
+	kind, exists := parseColorKind(words[0])
+	if !exists {
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("No such kind of output! Choose from %s", strings.Join(colorKinds, ", ")),
+			err:    true,
+		})
+		return
+	}
+	if words[1] == "reset" {
+		delete(p.colors, colorKinds[kind])
+		p.buildPalette()
+		p.sendDisplay(fmt.Sprintf("%s is back to the theme's color.", colorKinds[kind]))
+		return
+	}
+	if _, err := parseColor(words[1]); err != nil {
+		p.send(event{
+			player: p,
+			output: err.Error(),
+			err:    true,
+		})
+		return
+	}
+	p.colors[colorKinds[kind]] = words[1]
+	p.buildPalette()
+	p.sendDisplay(fmt.Sprintf("%s is now %s.", colorKinds[kind], ansiWrap(words[1], kind)))
+}
+
+// Send a message along with the player's display settings, after changing them
+func (p *player) sendDisplay(output string) {
+	display := p.display
+	p.send(event{
+		player:  p,
+		output:  output,
+		display: &display,
+	})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// One move along a travel route
+type step struct {
+	dir int
+	to  int // The room the step should lead to, in case the world changed on the way
+}
+
+// Find the shortest route to the nearest room that matches, going only through rooms the player has visited and doors that are open.
+// Returns the steps and the room reached, or nil if no matching room can be reached
+func (p *player) findRoute(match func(r *room) bool) ([]step, *room) {
+	// How each room was first reached
+	type hop struct {
+		prev int
+		dir  int
+	}
+	came := map[int]hop{p.room.id: {prev: -1}}
+	q := []*room{p.room}
+	for len(q) > 0 {
+		here := q[0]
+		q = q[1:]
+		if here != p.room && match(here) {
+			route := []step{}
+			for id := here.id; id != p.room.id; id = came[id].prev {
+				route = append([]step{{dir: came[id].dir, to: id}}, route...)
+			}
+			return route, here
+		}
+		for dir, e := range here.exits {
+			if !e.visible() || e.blocked() || !p.visited[e.to.id] {
+				continue
+			}
+			if _, seen := came[e.to.id]; !seen {
+				came[e.to.id] = hop{prev: here.id, dir: dir}
+				q = append(q, e.to)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Take the next step of a travel route, and schedule the one after
+func (p *player) travelStep(route []step) {
+	p.traveling = nil
+	s := route[0]
+	e := p.room.exits[s.dir]
+	switch {
+	case p.fighting != nil:
+		p.send(event{
+			player: p,
+			output: "You stop traveling to fight.",
+		})
+		return
+	case e.to == nil || e.to.id != s.to || e.blocked():
+		p.send(event{
+			player: p,
+			output: "Your way is blocked, you stop traveling.",
+		})
+		return
+	}
+	p.moveToRoom(e.to)
+	if len(route) == 1 {
+		p.send(event{
+			player: p,
+			output: "You have arrived.",
+		})
+		return
+	}
+	p.traveling = sched.after(time.Duration(cfg.TravelDelay), func() { p.travelStep(route[1:]) })
+}
+
+// Stop walking a travel route, if the player is on one
+func (p *player) stopTravel(reason string) {
+	if p.traveling == nil {
+		return
+	}
+	sched.cancel(p.traveling)
+	p.traveling = nil
+	if reason != "" {
+		p.send(event{
+			player: p,
+			output: reason,
+		})
+	}
+}
+
+// Navigation
+
+// Walk to a bookmark or a visited room by name, a step at a time
+func (p *player) doTravel(cmd string) {
+	target := strings.ToLower(strings.TrimSpace(cmd))
+	if target == "" {
+		p.send(event{
+			player: p,
+			output: "Usage: travel <bookmark|room name>",
+			err:    true,
+		})
+		return
+	}
+	if p.fighting != nil {
+		p.send(event{
+			player: p,
+			output: "You can't travel while fighting!",
+		})
+		return
+	}
+	match := func(r *room) bool { return p.visited[r.id] && strings.Contains(strings.ToLower(r.name), target) }
+	if id, exists := p.bookmarks[target]; exists {
+		match = func(r *room) bool { return r.id == id }
+	}
+	if match(p.room) {
+		p.send(event{
+			player: p,
+			output: "You are already there.",
+		})
+		return
+	}
+	route, dest := p.findRoute(match)
+	if route == nil {
+		output := fmt.Sprintf("You don't know any place called '%s'.", cmd)
+		if visited := p.roomsVisited(); contain(len(visited), func(idx int) bool { return match(visited[idx]) }) {
+			output = fmt.Sprintf("You can't find a way to '%s' from here.", cmd)
+		}
+		p.send(event{
+			player: p,
+			output: output,
+		})
+		return
+	}
+	p.send(event{
+		player: p,
+		output: fmt.Sprintf("You set off for %s, %d %s away.", dest.name, len(route), plural(len(route), "step")),
+	})
+	p.traveling = sched.after(time.Duration(cfg.TravelDelay), func() { p.travelStep(route) })
+}
+
+// The rooms the player has visited that still exist
+func (p *player) roomsVisited() []*room {
+	visited := []*room{}
+	for id := range p.visited {
+		if r, exists := rooms[id]; exists {
+			visited = append(visited, r)
+		}
+	}
+	return visited
+}
+
+// List, add or remove named places to travel to
+func (p *player) doBookmark(cmd string) {
+	words := strings.Fields(strings.ToLower(cmd))
+	switch {
+	case len(words) == 0:
+		if len(p.bookmarks) == 0 {
+			p.send(event{
+				player: p,
+				output: "You have no bookmarks. Use 'bookmark <name>' to mark this room.",
+			})
+			return
+		}
+		names := []string{}
+		for name := range p.bookmarks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		output := "Bookmarks:"
+		for _, name := range names {
+			where := "somewhere that is gone"
+			if r, exists := rooms[p.bookmarks[name]]; exists {
+				where = r.name
+			}
+			output += fmt.Sprintf("\n  %-15s %s", name, where)
+		}
+		p.send(event{
+			player: p,
+			output: output,
+		})
+	case words[0] == "remove" && len(words) == 2:
+		if _, exists := p.bookmarks[words[1]]; !exists {
+			p.send(event{
+				player: p,
+				output: fmt.Sprintf("You have no bookmark called '%s'.", words[1]),
+				err:    true,
+			})
+			return
+		}
+		delete(p.bookmarks, words[1])
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("Removed the bookmark '%s'.", words[1]),
+		})
+	case len(words) == 1 && words[0] != "remove":
+		p.bookmarks[words[0]] = p.room.id
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("Bookmarked %s as '%s'. Use 'travel %s' to come back.", p.room.name, words[0], words[0]),
+		})
+	default:
+		p.send(event{
+			player: p,
+			output: "Usage: bookmark [name] | bookmark remove <name>",
+			err:    true,
+		})
+	}
+}
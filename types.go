@@ -1,22 +1,49 @@
 package main
 
 import (
+	"bufio"
 	"log"
-	"net"
 	"time"
 )
 
 type (
 	player struct {
-		name      string       // Username
-		conn      net.Conn     // Connection
-		log       *log.Logger  // Client log
-		events    chan event   // MUD outgoing event channel
-		beginTime time.Time    // The beginning of the session
-		zone      *zone        // The current zone
-		room      *room        // The current room
-		minimap   *mapBuilder  // The displayed minimap
-		visited   map[int]bool // Visited rooms for the map
+		name      string            // Username
+		conn      *telnetConn       // Connection
+		log       *log.Logger       // Client log
+		events    chan event        // MUD outgoing event queue
+		linkDead  bool              // Set when the event queue overflowed and the connection was dropped
+		rebooting bool              // Set when the connection is kept open across a copyover
+		out       *bufio.Writer     // Buffered connection output, owned by the listenMUD goroutine
+		beginTime time.Time         // The beginning of the session
+		playTime  time.Duration     // Total play time from previous sessions
+		prefs     map[string]string // Preferences that differ from the defaults
+		zone      *zone             // The current zone
+		room      *room             // The current room
+		minimap   *mapBuilder       // The displayed minimap
+		visited   map[int]bool      // Visited rooms for the map
+		lastRoom  int               // The room the player was saved in
+		view      mapView           // The last minimap snapshot, owned by the listenMUD goroutine
+		inventory []*item           // Items the player is carrying
+		stats     stats             // Hit points and abilities
+		fighting  combatant         // Who the player is fighting, if anyone
+		rank      rank              // What the player is trusted to do
+		bookmarks map[string]int    // Room ids by the names the player gave them
+		traveling *timer            // The next step of a travel route, if the player is on one
+		mapZoom   int               // How closely the zone map is drawn
+		mapPages  []zonePage        // The last zone map drawn, a page at a time
+		mapPage   int               // The page of the zone map last shown
+		display   displayMode       // How output should be drawn, from preferences
+		screen    displayMode       // How output is drawn, owned by the listenMUD goroutine
+		theme     string            // The name of the built in color theme
+		colors    map[string]string // Colors the player chose over the theme's, by kind of output
+	}
+
+	// How a player's output is drawn
+	displayMode struct {
+		plain   bool // Lines of text only, with no cursor movement, minimap or prompt line
+		color   bool
+		palette map[colorKind]string // SGR parameters for each kind of output. Replaced, never changed
 	}
 
 	// A command with all it's info, including linked function
@@ -25,29 +52,36 @@ type (
 		category    commandCategory // The type of command
 		description string          // Short description of command
 		run         commandFunc     // The linked function
+		rank        rank            // The lowest rank allowed to use it
 	}
 
 	commandFunc func(*player, string) // A command run by a player
 
 	commandCategory int // A type of command
+	doorState       int // Whether a door is open, closed or locked
+	roomFlag        int // A bit set of room properties
+	rank            int // How much a player is trusted
 
 	// Input represents an event going from the player to MUD
 	input struct {
-		player *player // The sending player
-		text   string  // The raw text entered
-		end    bool    // Signals the connection should be terminated
+		player *player    // The sending player
+		text   string     // The raw text entered
+		end    bool       // Signals the connection should be terminated
+		idle   bool       // Set with end when the player timed out
+		join   chan error // Set when a logged in player asks to enter the world; receives the result
 	}
 
 	// Output represents an event going from MUD to the player
 	event struct {
-		player      *player  // The player who initiated the effect
-		output      string   // The string output to be printed to the recieving player
-		command     *command // The command tat caused this event
-		delay       int      // An optional delay (in milliseconds) after this prompt
-		unsolicited bool     // Whether the user pressed enter
-		noPrompt    bool     // Whether to draw the prompt again
-		updateMap   bool     // Whether to retrace the map
-		err         bool     // Prints in red
+		player      *player      // The player who initiated the effect
+		output      string       // The string output to be printed to the recieving player
+		command     *command     // The command tat caused this event
+		delay       int          // An optional delay (in milliseconds) after this prompt
+		unsolicited bool         // Whether the user pressed enter
+		noPrompt    bool         // Whether to draw the prompt again
+		minimap     *mapView     // A freshly traced minimap to display from now on
+		display     *displayMode // A new way of drawing output to use from now on
+		err         bool         // Prints in the error color
 	}
 
 	// An area of the world
@@ -66,11 +100,71 @@ type (
 		description string
 		exits       [6]exit   // The connections from this room to others
 		players     []*player // All players currently in the room
+		items       []*item   // Items lying in the room
+		mobs        []*mob    // Mobiles currently in the room
+		flags       roomFlag  // Special rules for the room
+	}
+
+	// A kind of thing that can be picked up
+	object struct {
+		id          int
+		keywords    []string // Words that refer to it
+		name        string   // Short description, e.g. "a small dagger"
+		ground      string   // Shown when it lies in a room
+		description string   // Shown when examined
+	}
+
+	// A single copy of an object somewhere in the world
+	item struct {
+		id     int
+		object *object
+	}
+
+	// A kind of non-player character
+	mobile struct {
+		id          int
+		keywords    []string          // Words that refer to it
+		name        string            // Short description, e.g. "the cityguard"
+		description string            // Shown when examined
+		wander      int               // Percent chance to move each time mobiles wander
+		stayZone    bool              // Whether it wanders out of its zone
+		stats       stats             // Hit points are the maximum
+		attack      string            // How it hurts people, e.g. "bite"
+		sayings     map[string]string // Replies to words said in the room
+		reactions   map[string]string // Replies to emotes aimed at it, by command name
+	}
+
+	// A single mobile walking around the world
+	mob struct {
+		id       int
+		mobile   *mobile
+		room     *room
+		home     *room // Where it comes back to life
+		stats    stats
+		fighting combatant
+	}
+
+	// What a player or mobile fights with
+	stats struct {
+		hp        int // Hit points left
+		maxHP     int
+		strength  int // Harder hits
+		dexterity int // Hitting more often and being hit less
 	}
 
 	// A connection between rooms
 	exit struct {
 		to          *room // Where this exit leads to
 		description string
+		door        *door // Nil if nothing blocks the way
+		hidden      bool  // Whether the exit goes unmentioned while its door is closed
+	}
+
+	// A door, gate or hatch, shared by the exits on both sides of it
+	door struct {
+		name      string // What it is called, e.g. "gate"
+		state     doorState
+		key       int  // Object id of the key that locks it, 0 if it has no lock
+		pickproof bool // Whether the lock resists picking
 	}
 )
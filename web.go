@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 4096,
+	}
+
+	// Everything the browser client loads, by path
+	webAssets = map[string]webAsset{
+		"/":         {"text/html; charset=utf-8", webPage},
+		"/term.js":  {"text/javascript; charset=utf-8", termScript},
+		"/term.css": {"text/css; charset=utf-8", termStyle},
+	}
+)
+
+type webAsset struct {
+	contentType string
+	content     string
+}
+
+// Serve the browser client and accept WebSocket connections.
+// Each socket carries the same telnet stream a TCP client would see
+func listenWeb(inputs chan input) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		asset, exists := webAssets[r.URL.Path]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", asset.contentType)
+		io.WriteString(w, asset.content)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			serverLog.Printf("WebSocket upgrade from %s failed: %v", r.RemoteAddr, err)
+			return
+		}
+		go handleConnection(newTelnetConn(&wsConn{Conn: ws}), inputs)
+	})
+
+	serverLog.Printf("Listening for web clients on %s (local address %s)\n", cfg.Web, serverAddress)
+	if err := http.ListenAndServe(cfg.Web, mux); err != nil {
+		serverLog.Fatalf("Error starting web server on %s: %v", cfg.Web, err)
+	}
+}
+
+// Adapts a WebSocket to the net.Conn interface.
+// Messages are treated as a continuous byte stream
+type wsConn struct {
+	*websocket.Conn
+	reader  io.Reader  // The message currently being read
+	writeMu sync.Mutex // WebSockets allow only one concurrent writer
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, r, err := c.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			// Move on to the next message
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
@@ -0,0 +1,131 @@
+package main
+
+// The browser client served by listenWeb.
+// It speaks just enough telnet to report its size and hide password input
+const webPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>MUD</title>
+<link rel="stylesheet" href="/term.css">
+<script src="/term.js"></script>
+<style>
+	html, body { height: 100%; margin: 0; background: #000; }
+	#terminal { height: 100%; box-sizing: border-box; padding: 2px; }
+</style>
+</head>
+<body>
+<div id="terminal"></div>
+<script>
+	var IAC = 255, DONT = 254, DO = 253, WONT = 252, WILL = 251, SB = 250, SE = 240;
+	var ECHO = 1, TTYPE = 24, NAWS = 31;
+
+	var term = new Term.Terminal(document.getElementById("terminal"));
+	term.focus();
+
+	var scheme = location.protocol === "https:" ? "wss://" : "ws://";
+	var ws = new WebSocket(scheme + location.host + "/ws");
+	ws.binaryType = "arraybuffer";
+
+	var localEcho = true; // Off while the server hides input
+	var line = "";
+	var encoder = new TextEncoder();
+
+	function send(bytes) {
+		if (ws.readyState === WebSocket.OPEN) {
+			ws.send(new Uint8Array(bytes));
+		}
+	}
+
+	function sendSize() {
+		var w = term.cols, h = term.rows;
+		send([IAC, SB, NAWS, w >> 8, w & 255, h >> 8, h & 255, IAC, SE]);
+	}
+
+	// Strip telnet commands from server output, answering the ones we understand
+	var state = 0, verb = 0, sub = [];
+	function parse(data) {
+		var out = [];
+		for (var i = 0; i < data.length; i++) {
+			var c = data[i];
+			switch (state) {
+			case 0:
+				if (c === IAC) { state = 1; } else { out.push(c); }
+				break;
+			case 1:
+				if (c === IAC) { out.push(c); state = 0; }
+				else if (c === SB) { sub = []; state = 3; }
+				else if (c >= WILL && c <= DONT) { verb = c; state = 2; }
+				else { state = 0; }
+				break;
+			case 2:
+				negotiate(verb, c);
+				state = 0;
+				break;
+			case 3:
+				if (c === IAC) { state = 4; } else { sub.push(c); }
+				break;
+			case 4:
+				if (c === SE) {
+					if (sub[0] === TTYPE && sub[1] === 1) {
+						send([IAC, SB, TTYPE, 0].concat(Array.from(encoder.encode("xterm-256color")), [IAC, SE]));
+					}
+					state = 0;
+				} else { sub.push(c); state = 3; }
+				break;
+			}
+		}
+		return new Uint8Array(out);
+	}
+
+	function negotiate(verb, opt) {
+		if (verb === DO && opt === NAWS) {
+			send([IAC, WILL, NAWS]);
+			sendSize();
+		} else if (verb === DO && opt === TTYPE) {
+			send([IAC, WILL, TTYPE]);
+		} else if (verb === DO) {
+			send([IAC, WONT, opt]);
+		} else if (verb === WILL && opt === ECHO) {
+			localEcho = false;
+		} else if (verb === WONT && opt === ECHO) {
+			localEcho = true;
+		}
+	}
+
+	ws.onmessage = function (msg) {
+		term.write(parse(new Uint8Array(msg.data)));
+	};
+	ws.onclose = function () {
+		term.write("\r\n\x1b[31mConnection closed\x1b[0m\r\n");
+	};
+
+	// Line editing happens locally, like a telnet client in line mode
+	term.onData(function (data) {
+		for (var i = 0; i < data.length; i++) {
+			var ch = data[i];
+			if (ch === "\r") {
+				send(Array.from(encoder.encode(line + "\r\n")));
+				term.write("\r\n");
+				line = "";
+			} else if (ch === "\x7f" || ch === "\b") {
+				if (line.length > 0) {
+					line = line.slice(0, -1);
+					if (localEcho) { term.write("\b \b"); }
+				}
+			} else if (ch === "\x1b") {
+				// Ignore the rest of an escape sequence, e.g. arrow keys
+				break;
+			} else if (ch >= " ") {
+				line += ch;
+				if (localEcho) { term.write(ch); }
+			}
+		}
+	});
+
+	term.onResize(sendSize);
+	window.addEventListener("resize", function () { term.fit(); });
+</script>
+</body>
+</html>
+`
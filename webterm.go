@@ -0,0 +1,447 @@
+package main
+
+// The terminal the browser client draws in, served by listenWeb so the page needs nothing from other sites.
+// It understands the control sequences the server sends: cursor movement, erasing and colors
+const termScript = `var Term = (function () {
+	var maxHistory = 1000; // Lines kept after scrolling off the top
+
+	// The 256 color palette: 16 basic colors, a 6x6x6 cube and a ramp of grays
+	var palette = ["#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+		"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff"];
+	var levels = [0, 95, 135, 175, 215, 255];
+	for (var i = 0; i < 216; i++) {
+		palette.push(rgb(levels[Math.floor(i / 36)], levels[Math.floor(i / 6) % 6], levels[i % 6]));
+	}
+	for (var i = 0; i < 24; i++) {
+		palette.push(rgb(8 + i * 10, 8 + i * 10, 8 + i * 10));
+	}
+
+	function rgb(r, g, b) {
+		return "rgb(" + r + "," + g + "," + b + ")";
+	}
+
+	function escapeHTML(text) {
+		return text.replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;");
+	}
+
+	function blank() {
+		return { ch: " ", css: "" };
+	}
+
+	function blankLine(cols) {
+		var line = [];
+		for (var i = 0; i < cols; i++) {
+			line.push(blank());
+		}
+		return line;
+	}
+
+	function Terminal(el) {
+		var t = this;
+		t.el = el;
+		t.el.className = "term";
+		t.history = document.createElement("div");
+		t.screen = document.createElement("div");
+		t.input = document.createElement("textarea");
+		t.input.className = "term-input";
+		t.input.setAttribute("autocapitalize", "off");
+		t.input.setAttribute("autocomplete", "off");
+		t.input.spellcheck = false;
+		el.appendChild(t.history);
+		el.appendChild(t.screen);
+		el.appendChild(t.input);
+
+		t.cols = 0;
+		t.rows = 0;
+		t.lines = [];
+		t.x = 0;
+		t.y = 0;
+		t.wrapNext = false; // The last column was just written, the next character starts a new line
+		t.fg = null;
+		t.bg = null;
+		t.bold = false;
+		t.css = "";
+		t.state = 0; // 0 for text, 1 after ESC, 2 inside a control sequence
+		t.params = "";
+		t.decoder = new TextDecoder();
+		t.dataHandlers = [];
+		t.resizeHandlers = [];
+		t.dirty = {};
+		t.drawing = false;
+
+		el.addEventListener("mouseup", function () {
+			// Leave text being selected alone
+			if (!window.getSelection().toString()) {
+				t.focus();
+			}
+		});
+		t.input.addEventListener("keydown", function (e) {
+			var keys = { Enter: "\r", Backspace: "\x7f", ArrowUp: "\x1b[A", ArrowDown: "\x1b[B", ArrowRight: "\x1b[C", ArrowLeft: "\x1b[D" };
+			if (keys[e.key] !== undefined) {
+				e.preventDefault();
+				t.emit(keys[e.key]);
+			}
+		});
+		// Typed, pasted and composed text all arrive here
+		t.input.addEventListener("input", function () {
+			var text = t.input.value.replace(/\r?\n/g, "\r");
+			t.input.value = "";
+			if (text) {
+				t.emit(text);
+			}
+		});
+		t.fit();
+	}
+
+	Terminal.prototype.onData = function (handler) {
+		this.dataHandlers.push(handler);
+	};
+
+	Terminal.prototype.onResize = function (handler) {
+		this.resizeHandlers.push(handler);
+	};
+
+	Terminal.prototype.emit = function (data) {
+		this.dataHandlers.forEach(function (handler) { handler(data); });
+	};
+
+	Terminal.prototype.focus = function () {
+		this.input.focus({ preventScroll: true });
+	};
+
+	// Size the screen to fill its element
+	Terminal.prototype.fit = function () {
+		var probe = document.createElement("div");
+		probe.style.display = "inline-block";
+		probe.textContent = "MMMMMMMMMM";
+		this.screen.appendChild(probe);
+		var size = probe.getBoundingClientRect();
+		this.screen.removeChild(probe);
+		var cols = Math.max(20, Math.floor(this.el.clientWidth / (size.width / 10)));
+		var rows = Math.max(5, Math.floor(this.el.clientHeight / size.height));
+		this.resize(cols, rows);
+	};
+
+	Terminal.prototype.resize = function (cols, rows) {
+		if (cols === this.cols && rows === this.rows) {
+			return;
+		}
+		this.lines.forEach(function (line) {
+			line.length = Math.min(line.length, cols);
+			while (line.length < cols) {
+				line.push(blank());
+			}
+		});
+		while (this.lines.length > rows) {
+			if (this.y > 0) {
+				this.scrollOff(this.lines.shift());
+				this.y--;
+			} else {
+				this.lines.pop();
+			}
+		}
+		while (this.lines.length < rows) {
+			this.lines.push(blankLine(cols));
+		}
+		this.cols = cols;
+		this.rows = rows;
+		this.x = Math.min(this.x, cols - 1);
+		this.y = Math.min(this.y, rows - 1);
+		this.wrapNext = false;
+		this.redrawAll();
+		this.resizeHandlers.forEach(function (handler) { handler({ cols: cols, rows: rows }); });
+	};
+
+	// Show text or bytes of UTF-8 from the server
+	Terminal.prototype.write = function (data) {
+		var text = typeof data === "string" ? data : this.decoder.decode(data, { stream: true });
+		var follow = this.el.scrollTop + this.el.clientHeight >= this.el.scrollHeight - 2;
+		var chars = Array.from(text);
+		for (var i = 0; i < chars.length; i++) {
+			this.feed(chars[i]);
+		}
+		this.draw(follow);
+	};
+
+	Terminal.prototype.feed = function (ch) {
+		switch (this.state) {
+		case 1:
+			if (ch === "[") {
+				this.state = 2;
+				this.params = "";
+			} else {
+				this.state = 0;
+			}
+			return;
+		case 2:
+			var code = ch.charCodeAt(0);
+			if (code >= 0x40 && code <= 0x7e) {
+				this.state = 0;
+				this.control(this.params, ch);
+			} else {
+				this.params += ch;
+			}
+			return;
+		}
+		switch (ch) {
+		case "\x1b":
+			this.state = 1;
+			break;
+		case "\r":
+			this.moveTo(0, this.y);
+			break;
+		case "\n":
+			this.wrapNext = false;
+			this.lineFeed();
+			break;
+		case "\b":
+			this.moveTo(this.x - 1, this.y);
+			break;
+		default:
+			if (ch < " ") {
+				return;
+			}
+			if (this.wrapNext) {
+				this.x = 0;
+				this.lineFeed();
+				this.wrapNext = false;
+			}
+			this.lines[this.y][this.x] = { ch: ch, css: this.css };
+			this.dirty[this.y] = true;
+			if (this.x === this.cols - 1) {
+				this.wrapNext = true;
+			} else {
+				this.x++;
+			}
+		}
+	};
+
+	Terminal.prototype.lineFeed = function () {
+		this.dirty[this.y] = true;
+		if (this.y < this.rows - 1) {
+			this.y++;
+		} else {
+			this.scrollOff(this.lines.shift());
+			this.lines.push(blankLine(this.cols));
+			this.redrawAll();
+		}
+		this.dirty[this.y] = true;
+	};
+
+	// Keep a line that went off the top of the screen
+	Terminal.prototype.scrollOff = function (line) {
+		var row = document.createElement("div");
+		row.innerHTML = this.lineHTML(line, -1);
+		this.history.appendChild(row);
+		while (this.history.childNodes.length > maxHistory) {
+			this.history.removeChild(this.history.firstChild);
+		}
+	};
+
+	Terminal.prototype.moveTo = function (x, y) {
+		this.dirty[this.y] = true;
+		this.x = Math.max(0, Math.min(this.cols - 1, x));
+		this.y = Math.max(0, Math.min(this.rows - 1, y));
+		this.wrapNext = false;
+		this.dirty[this.y] = true;
+	};
+
+	Terminal.prototype.erase = function (y, from, to) {
+		for (var x = from; x < to; x++) {
+			this.lines[y][x] = blank();
+		}
+		this.dirty[y] = true;
+	};
+
+	// Run a control sequence, ESC [ params final
+	Terminal.prototype.control = function (params, final) {
+		if (/^[?=>]/.test(params)) {
+			// Private modes aren't used
+			return;
+		}
+		var args = params.split(";").map(function (arg) { return parseInt(arg, 10) || 0; });
+		var n = Math.max(1, args[0]);
+		switch (final) {
+		case "A":
+			this.moveTo(this.x, this.y - n);
+			break;
+		case "B":
+			this.moveTo(this.x, this.y + n);
+			break;
+		case "C":
+			this.moveTo(this.x + n, this.y);
+			break;
+		case "D":
+			this.moveTo(this.x - n, this.y);
+			break;
+		case "E":
+			this.moveTo(0, this.y + n);
+			break;
+		case "G":
+			this.moveTo(n - 1, this.y);
+			break;
+		case "H":
+		case "f":
+			this.moveTo(Math.max(1, args[1] || 1) - 1, n - 1);
+			break;
+		case "J":
+			if (args[0] === 0) {
+				this.erase(this.y, this.x, this.cols);
+				for (var y = this.y + 1; y < this.rows; y++) {
+					this.erase(y, 0, this.cols);
+				}
+			} else if (args[0] === 1) {
+				for (var y = 0; y < this.y; y++) {
+					this.erase(y, 0, this.cols);
+				}
+				this.erase(this.y, 0, this.x + 1);
+			} else {
+				for (var y = 0; y < this.rows; y++) {
+					this.erase(y, 0, this.cols);
+				}
+			}
+			break;
+		case "K":
+			if (args[0] === 0) {
+				this.erase(this.y, this.x, this.cols);
+			} else if (args[0] === 1) {
+				this.erase(this.y, 0, this.x + 1);
+			} else {
+				this.erase(this.y, 0, this.cols);
+			}
+			break;
+		case "m":
+			this.setStyle(args);
+			break;
+		}
+	};
+
+	// Select graphic rendition: bold, and basic, 256 and true colors
+	Terminal.prototype.setStyle = function (args) {
+		for (var i = 0; i < args.length; i++) {
+			var a = args[i];
+			if (a === 0) {
+				this.fg = this.bg = null;
+				this.bold = false;
+			} else if (a === 1) {
+				this.bold = true;
+			} else if (a === 22) {
+				this.bold = false;
+			} else if (a >= 30 && a <= 37) {
+				this.fg = palette[a - 30];
+			} else if (a >= 90 && a <= 97) {
+				this.fg = palette[a - 90 + 8];
+			} else if (a === 39) {
+				this.fg = null;
+			} else if (a >= 40 && a <= 47) {
+				this.bg = palette[a - 40];
+			} else if (a >= 100 && a <= 107) {
+				this.bg = palette[a - 100 + 8];
+			} else if (a === 49) {
+				this.bg = null;
+			} else if ((a === 38 || a === 48) && args[i + 1] === 5) {
+				this[a === 38 ? "fg" : "bg"] = palette[args[i + 2] & 255];
+				i += 2;
+			} else if ((a === 38 || a === 48) && args[i + 1] === 2) {
+				this[a === 38 ? "fg" : "bg"] = rgb(args[i + 2] & 255, args[i + 3] & 255, args[i + 4] & 255);
+				i += 4;
+			}
+		}
+		this.css = (this.fg ? "color:" + this.fg + ";" : "") +
+			(this.bg ? "background:" + this.bg + ";" : "") +
+			(this.bold ? "font-weight:bold;" : "");
+	};
+
+	// The HTML for a line, with the cursor drawn at column cursor
+	Terminal.prototype.lineHTML = function (line, cursor) {
+		var html = "";
+		var run = "", css = null;
+		function flush() {
+			if (run) {
+				html += css ? "<span style=\"" + css + "\">" + escapeHTML(run) + "</span>" : escapeHTML(run);
+			}
+			run = "";
+		}
+		for (var x = 0; x < line.length; x++) {
+			if (x === cursor) {
+				flush();
+				html += "<span class=\"term-cursor\">" + escapeHTML(line[x].ch) + "</span>";
+				continue;
+			}
+			if (line[x].css !== css) {
+				flush();
+				css = line[x].css;
+			}
+			run += line[x].ch;
+		}
+		flush();
+		return html;
+	};
+
+	Terminal.prototype.redrawAll = function () {
+		for (var y = 0; y < this.rows; y++) {
+			this.dirty[y] = true;
+		}
+		this.draw(true);
+	};
+
+	// Update the changed lines on the next frame
+	Terminal.prototype.draw = function (follow) {
+		var t = this;
+		t.follow = t.follow || follow;
+		if (t.drawing) {
+			return;
+		}
+		t.drawing = true;
+		window.requestAnimationFrame(function () {
+			t.drawing = false;
+			while (t.screen.childNodes.length > t.rows) {
+				t.screen.removeChild(t.screen.lastChild);
+			}
+			while (t.screen.childNodes.length < t.rows) {
+				t.screen.appendChild(document.createElement("div"));
+			}
+			for (var y in t.dirty) {
+				if (y < t.rows) {
+					t.screen.childNodes[y].innerHTML = t.lineHTML(t.lines[y], Number(y) === t.y ? t.x : -1);
+				}
+			}
+			t.dirty = {};
+			if (t.follow) {
+				t.el.scrollTop = t.el.scrollHeight;
+			}
+			t.follow = false;
+		});
+	};
+
+	return { Terminal: Terminal };
+})();
+`
+
+// Styles for termScript
+const termStyle = `.term {
+	height: 100%;
+	overflow-y: auto;
+	position: relative;
+	background: #000;
+	color: #e5e5e5;
+	font-family: "DejaVu Sans Mono", Menlo, Consolas, monospace;
+	font-size: 15px;
+	line-height: 1.2;
+	white-space: pre;
+}
+.term div {
+	height: 1.2em;
+}
+.term-cursor {
+	background: #e5e5e5;
+	color: #000;
+}
+.term-input {
+	position: absolute;
+	left: -9999px;
+	width: 1px;
+	height: 1px;
+	opacity: 0;
+}
+`
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	exportDirections = "neswud" // The order exits are written in
+	// The world tables from before migrations, for building a database from scratch
+	baseSchema = `CREATE TABLE zones (
+		id              INTEGER PRIMARY KEY,
+		name            TEXT NOT NULL
+	);
+	CREATE TABLE rooms (
+		id              INTEGER PRIMARY KEY,
+		zone_id         INTEGER NOT NULL,
+		name            TEXT NOT NULL,
+		description     TEXT NOT NULL,
+		FOREIGN KEY(zone_id) REFERENCES zones(id)
+	);
+	CREATE TABLE exits (
+		from_room_id    INTEGER NOT NULL,
+		to_room_id      INTEGER NOT NULL,
+		direction       TEXT NOT NULL CHECK(direction IN ('n','e','s','w','u','d')),
+		description     TEXT NOT NULL,
+		PRIMARY KEY(from_room_id, direction),
+		FOREIGN KEY(from_room_id) REFERENCES rooms(id),
+		FOREIGN KEY(to_room_id) REFERENCES rooms(id)
+	)`
+)
+
+type (
+	// One zone and its rooms as written to a text file.
+	// Descriptions are kept as lists of lines so a change shows up as a changed line
+	zoneFile struct {
+		ID    int        `json:"id"`
+		Name  string     `json:"name"`
+		Rooms []roomFile `json:"rooms"`
+	}
+
+	roomFile struct {
+		ID          int        `json:"id"`
+		Name        string     `json:"name"`
+		Description []string   `json:"description"`
+		Flags       string     `json:"flags,omitempty"`
+		Exits       []exitFile `json:"exits,omitempty"`
+	}
+
+	exitFile struct {
+		Direction   string   `json:"direction"`
+		To          int      `json:"to"`
+		Description []string `json:"description"`
+		Door        string   `json:"door,omitempty"`      // Left out for exits without a door
+		DoorName    string   `json:"door_name,omitempty"` // Left out for doors just called "door"
+		Hidden      bool     `json:"hidden,omitempty"`
+		Key         int      `json:"key,omitempty"`
+		Pickproof   bool     `json:"pickproof,omitempty"`
+	}
+)
+
+// Open the world database for a tool and bring its schema up to date
+func openWorldDatabase(path string) error {
+	var err error
+	db, err = sql.Open("sqlite3", path+options)
+	if err != nil {
+		return fmt.Errorf("opening database: %v", err)
+	}
+	if err := migrate(); err != nil {
+		return fmt.Errorf("updating schema: %v", err)
+	}
+	return nil
+}
+
+// Read every zone with its rooms and exits, in id order
+func readZoneFiles(tx *sql.Tx) ([]*zoneFile, error) {
+	byID := make(map[int]*zoneFile)
+	rows, err := tx.Query("SELECT id, name FROM zones ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("querying zones: %v", err)
+	}
+	defer rows.Close()
+	var all []*zoneFile
+	for rows.Next() {
+		z := &zoneFile{Rooms: []roomFile{}}
+		if err := rows.Scan(&z.ID, &z.Name); err != nil {
+			return nil, fmt.Errorf("reading a zone: %v", err)
+		}
+		byID[z.ID] = z
+		all = append(all, z)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating over zones: %v", err)
+	}
+
+	exits := make(map[int][]exitFile)
+	rows, err = tx.Query("SELECT from_room_id, to_room_id, direction, description, door, door_name, hidden, key_id, pickproof FROM exits")
+	if err != nil {
+		return nil, fmt.Errorf("querying exits: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			from int
+			desc string
+			key  sql.NullInt64
+			e    exitFile
+		)
+		if err := rows.Scan(&from, &e.To, &e.Direction, &desc, &e.Door, &e.DoorName, &e.Hidden, &key, &e.Pickproof); err != nil {
+			return nil, fmt.Errorf("reading an exit: %v", err)
+		}
+		e.Description = strings.Split(desc, "\n")
+		e.Key = int(key.Int64)
+		if e.Door == "none" {
+			e.Door = ""
+		}
+		if e.Door == "" || e.DoorName == "door" {
+			e.DoorName = ""
+		}
+		exits[from] = append(exits[from], e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating over exits: %v", err)
+	}
+
+	rows, err = tx.Query("SELECT id, zone_id, name, description, flags FROM rooms ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("querying rooms: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r      roomFile
+			zoneID int
+			desc   string
+		)
+		if err := rows.Scan(&r.ID, &zoneID, &r.Name, &desc, &r.Flags); err != nil {
+			return nil, fmt.Errorf("reading a room: %v", err)
+		}
+		z := byID[zoneID]
+		if z == nil {
+			return nil, fmt.Errorf("room %d is in missing zone %d", r.ID, zoneID)
+		}
+		r.Description = strings.Split(desc, "\n")
+		r.Exits = exits[r.ID]
+		sort.Slice(r.Exits, func(i, j int) bool {
+			return strings.Index(exportDirections, r.Exits[i].Direction) < strings.Index(exportDirections, r.Exits[j].Direction)
+		})
+		z.Rooms = append(z.Rooms, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating over rooms: %v", err)
+	}
+	return all, nil
+}
+
+// Write one file per zone into dir, removing files for zones that are gone
+func writeZoneFiles(dir string, all []*zoneFile) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	for _, z := range all {
+		data, err := json.MarshalIndent(z, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding zone %d: %v", z.ID, err)
+		}
+		name := fmt.Sprintf("%d.json", z.ID)
+		keep[name] = true
+		if err := ioutil.WriteFile(filepath.Join(dir, name), append(data, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	old, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range old {
+		name := filepath.Base(path)
+		if _, err := strconv.Atoi(strings.TrimSuffix(name, ".json")); err == nil && !keep[name] {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Read the zone files in dir
+func loadZoneFiles(dir string) ([]*zoneFile, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no zone files in %s", dir)
+	}
+	var all []*zoneFile
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		z := &zoneFile{}
+		if err := json.Unmarshal(data, z); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		all = append(all, z)
+	}
+	return all, nil
+}
+
+// Check zone files can be linked into a world, the way loadWorld would link them.
+// Returns every problem found, not just the first
+func validateZoneFiles(all []*zoneFile, objectExists func(id int) bool) []string {
+	problems := []string{}
+	w := &worldRows{
+		zones: make(map[int]string),
+		rooms: make(map[int]roomRow),
+	}
+	for _, z := range all {
+		if _, dup := w.zones[z.ID]; dup {
+			problems = append(problems, fmt.Sprintf("zone %d is in more than one file", z.ID))
+		}
+		w.zones[z.ID] = z.Name
+		for _, r := range z.Rooms {
+			if _, dup := w.rooms[r.ID]; dup {
+				problems = append(problems, fmt.Sprintf("room %d is in more than one zone", r.ID))
+			}
+			w.rooms[r.ID] = roomRow{zone: z.ID, name: r.Name}
+			for _, flag := range strings.Fields(r.Flags) {
+				if _, known := roomFlagNames[strings.ToLower(flag)]; !known {
+					problems = append(problems, fmt.Sprintf("room %d has unknown flag %q", r.ID, flag))
+				}
+			}
+			seen := make(map[string]bool)
+			for _, e := range r.Exits {
+				if seen[e.Direction] {
+					problems = append(problems, fmt.Sprintf("room %d has more than one exit %s", r.ID, e.Direction))
+				}
+				seen[e.Direction] = true
+				if _, known := doorStates[e.Door]; e.Door != "" && !known {
+					problems = append(problems, fmt.Sprintf("exit %s of room %d has unknown door state %q", e.Direction, r.ID, e.Door))
+				}
+				if e.Key != 0 && !objectExists(e.Key) {
+					problems = append(problems, fmt.Sprintf("exit %s of room %d needs missing key %d", e.Direction, r.ID, e.Key))
+				}
+				w.exits = append(w.exits, exitRow{from: r.ID, to: e.To, dir: e.Direction})
+			}
+		}
+	}
+	// The same checks as 'mud lint', failing on anything that would be left out at load
+	for _, issue := range lintWorld(w, cfg.StartRoom) {
+		if issue.Severity == lintError {
+			problems = append(problems, issue.Message)
+		}
+	}
+	return problems
+}
+
+// Replace the zones, rooms and exits in the database with the ones from zone files.
+// Items and mobiles in rooms that are removed go with them
+func writeZones(tx *sql.Tx, all []*zoneFile) (removed int, err error) {
+	if _, err := tx.Exec("DELETE FROM exits"); err != nil {
+		return 0, fmt.Errorf("clearing exits: %v", err)
+	}
+	keepZones, keepRooms := make(map[int]bool), make(map[int]bool)
+	for _, z := range all {
+		keepZones[z.ID] = true
+		if _, err := tx.Exec("INSERT INTO zones (id, name) VALUES (?, ?) ON CONFLICT(id) DO UPDATE SET name = excluded.name", z.ID, z.Name); err != nil {
+			return 0, fmt.Errorf("writing zone %d: %v", z.ID, err)
+		}
+		for _, r := range z.Rooms {
+			keepRooms[r.ID] = true
+			_, err := tx.Exec(`INSERT INTO rooms (id, zone_id, name, description, flags) VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT(id) DO UPDATE SET zone_id = excluded.zone_id, name = excluded.name, description = excluded.description, flags = excluded.flags`,
+				r.ID, z.ID, r.Name, strings.Join(r.Description, "\n"), r.Flags)
+			if err != nil {
+				return 0, fmt.Errorf("writing room %d: %v", r.ID, err)
+			}
+		}
+	}
+
+	// Clear out what the files no longer have
+	gone := func(table string, keep map[int]bool) ([]int, error) {
+		rows, err := tx.Query("SELECT id FROM " + table)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var ids []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			if !keep[id] {
+				ids = append(ids, id)
+			}
+		}
+		return ids, rows.Err()
+	}
+	oldRooms, err := gone("rooms", keepRooms)
+	if err != nil {
+		return 0, fmt.Errorf("finding removed rooms: %v", err)
+	}
+	for _, id := range oldRooms {
+		for _, query := range []string{
+			"DELETE FROM items WHERE room_id = ?",
+			"DELETE FROM mobile_instances WHERE room_id = ?",
+			"DELETE FROM rooms WHERE id = ?",
+		} {
+			if _, err := tx.Exec(query, id); err != nil {
+				return 0, fmt.Errorf("removing room %d: %v", id, err)
+			}
+		}
+	}
+	oldZones, err := gone("zones", keepZones)
+	if err != nil {
+		return 0, fmt.Errorf("finding removed zones: %v", err)
+	}
+	for _, id := range oldZones {
+		if _, err := tx.Exec("DELETE FROM zones WHERE id = ?", id); err != nil {
+			return 0, fmt.Errorf("removing zone %d: %v", id, err)
+		}
+	}
+
+	for _, z := range all {
+		for _, r := range z.Rooms {
+			for _, e := range r.Exits {
+				door, name, key := e.Door, e.DoorName, sql.NullInt64{Int64: int64(e.Key), Valid: e.Key != 0}
+				if door == "" {
+					door = "none"
+				}
+				if name == "" {
+					name = "door"
+				}
+				_, err := tx.Exec("INSERT INTO exits (from_room_id, to_room_id, direction, description, door, door_name, hidden, key_id, pickproof) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+					r.ID, e.To, e.Direction, strings.Join(e.Description, "\n"), door, name, e.Hidden, key, e.Pickproof)
+				if err != nil {
+					return 0, fmt.Errorf("writing exit %s of room %d: %v", e.Direction, r.ID, err)
+				}
+			}
+		}
+	}
+	return len(oldRooms), nil
+}
+
+// The 'export' subcommand: write the world to one text file per zone
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("mud export", flag.ContinueOnError)
+	flags.StringVar(&cfg.Database, "db", cfg.Database, "path to the world database")
+	dir := flags.String("dir", "world", "directory to write zone files to")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if _, err := os.Stat(cfg.Database); err != nil {
+		fmt.Fprintf(os.Stderr, "opening database: %v\n", err)
+		return 1
+	}
+	if err := openWorldDatabase(cfg.Database); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	var all []*zoneFile
+	err := readTransaction(func(tx *sql.Tx) (err error) {
+		all, err = readZoneFiles(tx)
+		return err
+	})
+	if err == nil {
+		err = writeZoneFiles(*dir, all)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "exporting: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Exported %d %s to %s\n", len(all), plural(len(all), "zone"), *dir)
+	return 0
+}
+
+// The 'import' subcommand: rebuild the world in the database from zone files, if they are valid.
+// Creates the database if it doesn't exist yet
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("mud import", flag.ContinueOnError)
+	flags.StringVar(&cfg.Database, "db", cfg.Database, "path to the world database")
+	flags.IntVar(&cfg.StartRoom, "start", cfg.StartRoom, "room id every room should be reachable from")
+	dir := flags.String("dir", "world", "directory to read zone files from")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	createMaps()
+
+	all, err := loadZoneFiles(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reading zone files: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stat(cfg.Database); os.IsNotExist(err) {
+		if err := createWorldDatabase(cfg.Database); err != nil {
+			fmt.Fprintf(os.Stderr, "creating database: %v\n", err)
+			return 1
+		}
+	}
+	if err := openWorldDatabase(cfg.Database); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	var removed int
+	err = writeTransaction(func(tx *sql.Tx) error {
+		problems := validateZoneFiles(all, func(id int) bool {
+			exists, err := rowExists(tx, "objects", id)
+			return err == nil && exists
+		})
+		if len(problems) > 0 {
+			for _, problem := range problems {
+				fmt.Fprintln(os.Stderr, problem)
+			}
+			return fmt.Errorf("%d %s in the zone files, nothing was changed", len(problems), plural(len(problems), "problem"))
+		}
+		removed, err = writeZones(tx, all)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "importing: %v\n", err)
+		return 1
+	}
+	roomCount := 0
+	for _, z := range all {
+		roomCount += len(z.Rooms)
+	}
+	fmt.Printf("Imported %d %s and %d %s, removed %d %s\n",
+		len(all), plural(len(all), "zone"), roomCount, plural(roomCount, "room"), removed, plural(removed, "room"))
+	return 0
+}
+
+// Make a world database with the original tables and every migration, but no world yet.
+// Foreign keys are off while migrating, since the rows they seed refer to rooms that come later
+func createWorldDatabase(path string) error {
+	var err error
+	db, err = sql.Open("sqlite3", path+"?mode=rwc")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if _, err := db.Exec(baseSchema); err != nil {
+		return err
+	}
+	return migrate()
+}
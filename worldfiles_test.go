@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Copy the world that comes with the game, so tests can change it
+func copyWorld(t *testing.T, dir string) string {
+	data, err := ioutil.ReadFile("world.db")
+	if err != nil {
+		t.Fatalf("reading world.db: %v", err)
+	}
+	path := filepath.Join(dir, "world.db")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("copying world.db: %v", err)
+	}
+	return path
+}
+
+// Every zone in a database, as it would be exported
+func exportZones(t *testing.T, path string) []*zoneFile {
+	if err := openWorldDatabase(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var all []*zoneFile
+	err := readTransaction(func(tx *sql.Tx) (err error) {
+		all, err = readZoneFiles(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("reading zones from %s: %v", path, err)
+	}
+	return all
+}
+
+func TestZoneFilesRoundTrip(t *testing.T) {
+	createMaps()
+	// Like the tools, with nobody to read the server log
+	serverLog = log.New(ioutil.Discard, "", 0)
+	dir, err := ioutil.TempDir("", "mud-worldfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	original := exportZones(t, copyWorld(t, dir))
+	if len(original) == 0 {
+		t.Fatal("the world has no zones")
+	}
+
+	// Through files on disk
+	files := filepath.Join(dir, "world")
+	if err := writeZoneFiles(files, original); err != nil {
+		t.Fatalf("writing zone files: %v", err)
+	}
+	loaded, err := loadZoneFiles(files)
+	if err != nil {
+		t.Fatalf("loading zone files: %v", err)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].ID < loaded[j].ID })
+	if !reflect.DeepEqual(loaded, original) {
+		t.Fatal("zone files read back differently from how they were written")
+	}
+
+	// Into a new database, and out again
+	rebuilt := filepath.Join(dir, "rebuilt.db")
+	if err := createWorldDatabase(rebuilt); err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+	if err := openWorldDatabase(rebuilt); err != nil {
+		t.Fatal(err)
+	}
+	var problems []string
+	err = writeTransaction(func(tx *sql.Tx) error {
+		problems = validateZoneFiles(loaded, func(id int) bool {
+			exists, err := rowExists(tx, "objects", id)
+			return err == nil && exists
+		})
+		_, err := writeZones(tx, loaded)
+		return err
+	})
+	db.Close()
+	if len(problems) > 0 {
+		t.Fatalf("exported zone files have problems: %v", problems)
+	}
+	if err != nil {
+		t.Fatalf("importing: %v", err)
+	}
+	if again := exportZones(t, rebuilt); !reflect.DeepEqual(again, original) {
+		t.Fatal("the imported world exports differently from the original")
+	}
+}
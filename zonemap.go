@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Zoom levels for the zone map
+const (
+	zoomCompact = 1 // One character per room
+	zoomFull    = 2 // The boxes and arrows of the minimap
+)
+
+// A page of a zone map and the layer it shows
+type zonePage struct {
+	on    layer
+	title string
+	text  string // With the legend
+}
+
+const (
+	zoneMapDepth  = 500 // Far enough from the start to take in any zone
+	compactRoom   = 'o'
+	compactStairs = '+' // A room with a way up or down
+)
+
+// Draw one layer of a zone layout, marking the player if they are on it
+func (p *player) drawZone(l *layout, on layer, zoom int) map[pair]rune {
+	m := newMapBuilder(zoneMapDepth)
+	m.drawLayer(l, on, p.room, p.visited)
+	if zoom == zoomFull {
+		return m.text
+	}
+
+	// Rooms become single characters two apart, with passages between them
+	text := make(map[pair]rune)
+	for at, r := range m.grid {
+		ch := compactRoom
+		if r.exits[4].visible() || r.exits[5].visible() {
+			ch = compactStairs
+		}
+		if r == p.room {
+			ch = cross
+		}
+		text[pair{2 * at.x, 2 * at.y}] = ch
+		for dir := 0; dir < 4; dir++ {
+			e := r.exits[dir]
+			reach := 0
+			if e.visible() && e.to != nil {
+				reach = l.reach(r, dir)
+			}
+			if reach == 0 {
+				continue
+			}
+			passage := '|'
+			if dxByIndex[dir] != 0 {
+				passage = '-'
+			}
+			// Stretched passages run all the way to the room, with any door next to this one
+			for step := 2*reach - 1; step >= 1; step-- {
+				if step == 1 && e.blocked() {
+					passage = doorGlyphs[dir]
+				}
+				text[pair{2*at.x + step*dxByIndex[dir], 2*at.y + step*dyByIndex[dir]}] = passage
+			}
+		}
+	}
+	return text
+}
+
+// What the map glyphs mean, at a zoom level
+func mapLegend(zoom int) string {
+	if zoom == zoomCompact {
+		return fmt.Sprintf("%s you  %c room  %c stairs  - | passage  %s closed door",
+			ansiWrap(string(cross), colorMapYou), compactRoom, compactStairs, ansiWrap(string(doorGlyphs[0]), colorMapDoor))
+	}
+	return fmt.Sprintf("%s you  %c%c two-way  %c%c one-way  %s unexplored  %s other zone  %s elsewhere on the map  %c%c up/down  %s closed door",
+		ansiWrap(string(cross), colorMapYou),
+		biArrows[0], biArrows[1],
+		inZoneArrows[0], inZoneArrows[1],
+		ansiWrap(string(unknownArrows[:2]), colorMapUnexplored),
+		ansiWrap(string(outZoneArrows[:2]), colorMapZone),
+		ansiWrap(string(warpArrows[:2]), colorMapElsewhere),
+		biArrows[4], biArrows[5],
+		ansiWrap(string(doorGlyphs[0]), colorMapDoor))
+}
+
+// Cut a drawing into pieces that fit the event pane, left to right and then top to bottom
+func (p *player) tileMap(text map[pair]rune) [][]string {
+	left, right, top, bottom := 0, 0, 0, 0
+	first := true
+	for at := range text {
+		if first {
+			left, right, top, bottom = at.x, at.x, at.y, at.y
+			first = false
+		}
+		if at.x < left {
+			left = at.x
+		}
+		if at.x > right {
+			right = at.x
+		}
+		if at.y > top {
+			top = at.y
+		}
+		if at.y < bottom {
+			bottom = at.y
+		}
+	}
+	screenWidth, screenHeight := p.conn.size()
+	// Room for the title, legend and prompt
+	pageWidth, pageHeight := screenWidth-p.minimap.width-4, screenHeight-8
+	if p.display.plain {
+		pageWidth = screenWidth
+	}
+	if pageWidth < minTextWidth {
+		pageWidth = minTextWidth
+	}
+	if pageHeight < 5 {
+		pageHeight = 5
+	}
+
+	var tiles [][]string
+	for y := top; y >= bottom; y -= pageHeight {
+		for x := left; x <= right; x += pageWidth {
+			tiles = append(tiles, renderText(text, x, min(x+pageWidth-1, right), y, max(y-pageHeight+1, bottom)))
+		}
+	}
+	return tiles
+}
+
+// Draw every layer of a zone layout as pages, starting with the layer of the first room laid out
+func (p *player) pageMap(name string, l *layout, zoom int) []zonePage {
+	layers := l.layers()
+	pages := []zonePage{}
+	for _, on := range layers {
+		title := name
+		if len(layers) > 1 {
+			title = fmt.Sprintf("%s, %s", name, on)
+		}
+		for _, lines := range p.tileMap(p.drawZone(l, on, zoom)) {
+			pages = append(pages, zonePage{on: on, title: title, text: strings.Join(lines, "\n") + "\n" + mapLegend(zoom)})
+		}
+	}
+	for i := range pages {
+		hints := []string{}
+		if len(pages) > 1 {
+			hints = append(hints, fmt.Sprintf("page %d of %d, 'map next' for more", i+1, len(pages)))
+		}
+		if len(layers) > 1 {
+			hints = append(hints, "'map up' and 'map down' change level")
+		}
+		if len(hints) > 0 {
+			pages[i].title += fmt.Sprintf(" (%s)", strings.Join(hints, ", "))
+		}
+	}
+	return pages
+}
+
+// Find a zone the player has been in by part of its name
+func (p *player) findVisitedZone(name string) *zone {
+	name = strings.ToLower(name)
+	ids := []int{}
+	for id := range zones {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		z := zones[id]
+		if strings.Contains(strings.ToLower(z.name), name) && p.firstVisited(z) != nil {
+			return z
+		}
+	}
+	return nil
+}
+
+// The lowest numbered room of a zone the player has visited
+func (p *player) firstVisited(z *zone) *room {
+	var first *room
+	for _, r := range z.rooms {
+		if p.visited[r.id] && (first == nil || r.id < first.id) {
+			first = r
+		}
+	}
+	return first
+}
+
+func (p *player) applyMapZoom(value string) error {
+	zoom, err := strconv.Atoi(value)
+	if err != nil || zoom < zoomCompact || zoom > zoomFull {
+		return fmt.Errorf("The map zoom must be %d (compact) or %d (full)", zoomCompact, zoomFull)
+	}
+	p.mapZoom = zoom
+	return nil
+}
+
+// Show the next page of the last zone map
+func (p *player) showMapPage(page int) {
+	if page < 0 || page >= len(p.mapPages) {
+		p.send(event{
+			player: p,
+			output: "There are no more pages.",
+			err:    true,
+		})
+		return
+	}
+	p.mapPage = page
+	p.send(event{
+		player: p,
+		output: p.mapPages[page].title + "\n" + p.mapPages[page].text,
+	})
+}
+
+// Show the first page of the level above or below the one last shown, on the same sheet if it has one
+func (p *player) showMapLevel(dz int) {
+	if len(p.mapPages) == 0 {
+		p.send(event{
+			player: p,
+			output: "Draw a map first.",
+			err:    true,
+		})
+		return
+	}
+	from := p.mapPages[p.mapPage].on
+	found := -1
+	for i, page := range p.mapPages {
+		if page.on.z != from.z+dz {
+			continue
+		}
+		if found == -1 || page.on.sheet == from.sheet && p.mapPages[found].on.sheet != from.sheet {
+			found = i
+		}
+	}
+	if found == -1 {
+		where := "above"
+		if dz < 0 {
+			where = "below"
+		}
+		p.send(event{
+			player: p,
+			output: fmt.Sprintf("There is nothing mapped %s this level.", where),
+			err:    true,
+		})
+		return
+	}
+	p.showMapPage(found)
+}
+
+// Information
+
+// Draw the current zone, or another visited zone, in the event pane
+func (p *player) doMap(cmd string) {
+	words := strings.Fields(strings.ToLower(cmd))
+	z := p.zone
+	switch {
+	case len(words) == 1 && words[0] == "next":
+		p.showMapPage(p.mapPage + 1)
+		return
+	case len(words) == 1 && words[0] == "prev":
+		p.showMapPage(p.mapPage - 1)
+		return
+	case len(words) == 1 && words[0] == "up":
+		p.showMapLevel(1)
+		return
+	case len(words) == 1 && words[0] == "down":
+		p.showMapLevel(-1)
+		return
+	case len(words) == 2 && words[0] == "zoom":
+		p.doSet("mapzoom " + words[1])
+		return
+	case len(words) > 0:
+		if z = p.findVisitedZone(strings.Join(words, " ")); z == nil {
+			p.send(event{
+				player: p,
+				output: fmt.Sprintf("You haven't been anywhere called '%s'.", strings.TrimSpace(cmd)),
+				err:    true,
+			})
+			return
+		}
+	}
+	start := p.room
+	if z != p.zone {
+		start = p.firstVisited(z)
+	}
+	p.mapPages = p.pageMap(z.name, newZoneLayout(start, p.visited), p.mapZoom)
+	p.showMapPage(0)
+}